@@ -18,9 +18,11 @@ package main
 
 import (
 	"flag"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/metrics"
 	secretsstore "sigs.k8s.io/secrets-store-csi-driver/pkg/secrets-store"
 )
 
@@ -32,7 +34,22 @@ var (
 	logFormatJSON      = flag.Bool("log-format-json", false, "set log formatter to json")
 	logReportCaller    = flag.Bool("log-report-caller", false, "include the calling method as fields in the log")
 	providerVolumePath = flag.String("provider-volume", "/etc/kubernetes/secrets-store-csi-providers", "Volume path for provider")
-	minProviderVersion = flag.String("min-provider-version", "", "set minimum supported provider versions with current driver")
+	minProviderVersion = flag.String("min-provider-version", "", "set minimum supported provider versions or semver ranges of supported provider versions with current driver, e.g. provider1=0.0.2,provider2=>=0.0.5 <0.1.0")
+	providerTimeout    = flag.Duration("provider-timeout", 1*time.Minute, "maximum duration of a single provider call")
+	providerTimeouts   = flag.String("provider-timeouts", "", "set provider specific timeouts overriding --provider-timeout, e.g. provider1=30s,provider2=2m")
+	providerDigests    = flag.String("provider-digests", "", "allowed sha256 digests of the provider binaries, e.g. provider1=sha256:<digest>,provider2=sha256:<digest>. Providers can be listed multiple times to allow several digests")
+	providerPublicKey  = flag.String("provider-public-key", "", "PEM encoded rsa or ecdsa public key verifying the detached <binary>.sig signatures of the provider binaries without allowed digests")
+	enableRotation     = flag.Bool("enable-secret-rotation", false, "periodically update the mounted content and synced secrets with the latest content from the provider")
+	rotationInterval   = flag.Duration("rotation-poll-interval", 2*time.Minute, "interval between secret rotations")
+	enableOrphanGC     = flag.Bool("enable-orphan-cleanup", false, "on startup and periodically unmount the volumes of pods that no longer exist and delete their synced secrets")
+	orphanGCInterval   = flag.Duration("orphan-cleanup-interval", 10*time.Minute, "interval between orphaned volume cleanups")
+	orphanGCDryRun     = flag.Bool("orphan-cleanup-dry-run", false, "only report the orphaned volumes without cleaning them up")
+	stateDir           = flag.String("state-dir", "", "directory the state of the published volumes is persisted to so it can be recovered when the driver restarts. The state is only kept in memory if empty")
+	metricsAddr        = flag.String("metrics-addr", ":8095", "address the Prometheus metrics are served on at /metrics. The metrics endpoint is disabled if empty")
+	sharedSPCNamespace = flag.String("shared-secret-provider-class-namespace", "", "namespace of the secretproviderclass objects that can be used by pods in all namespaces. Objects in the pod namespace take precedence. Disabled by default")
+	secretSyncMode     = flag.String("secret-sync-mode", "inline", "how secretObjects are synced to K8s secrets: inline when volumes are published and rotated, or controller to only write the mounted content to a secret per volume referenced in its secretproviderclasspodstatus object, and sync the K8s secrets in the secret sync controller")
+	secretSyncCtrl     = flag.Bool("secret-sync-controller", false, "run the secret sync controller instead of the driver, e.g. in a Deployment, to sync the K8s secrets of the volumes published by drivers with --secret-sync-mode=controller")
+	secretSyncLeader   = flag.Bool("secret-sync-leader-election", false, "elect a single secret sync controller among its replicas with the secrets-store-csi-driver-secret-sync lock in the namespace of the controller")
 )
 
 func main() {
@@ -52,6 +69,38 @@ func main() {
 }
 
 func handle() {
+	if *metricsAddr != "" {
+		go func() {
+			log.Infof("serving metrics on %s", *metricsAddr)
+			if err := metrics.Serve(*metricsAddr); err != nil {
+				log.Fatalf("failed to serve metrics, error: %+v", err)
+			}
+		}()
+	}
+	opts := secretsstore.Options{
+		DriverName:                         *driverName,
+		NodeID:                             *nodeID,
+		Endpoint:                           *endpoint,
+		ProviderVolumePath:                 *providerVolumePath,
+		MinProviderVersions:                *minProviderVersion,
+		ProviderTimeout:                    *providerTimeout,
+		ProviderTimeouts:                   *providerTimeouts,
+		ProviderDigests:                    *providerDigests,
+		ProviderPublicKey:                  *providerPublicKey,
+		EnableSecretRotation:               *enableRotation,
+		RotationPollInterval:               *rotationInterval,
+		SharedSecretProviderClassNamespace: *sharedSPCNamespace,
+		StateDir:                           *stateDir,
+		EnableOrphanCleanup:                *enableOrphanGC,
+		OrphanCleanupInterval:              *orphanGCInterval,
+		OrphanCleanupDryRun:                *orphanGCDryRun,
+		SecretSyncMode:                     *secretSyncMode,
+		SecretSyncLeaderElection:           *secretSyncLeader,
+	}
+	if *secretSyncCtrl {
+		secretsstore.RunSecretSync(opts)
+		return
+	}
 	driver := secretsstore.GetDriver()
-	driver.Run(*driverName, *nodeID, *endpoint, *providerVolumePath, *minProviderVersion)
+	driver.Run(opts)
 }
@@ -27,6 +27,10 @@ import (
 	"google.golang.org/grpc"
 )
 
+// serviceAccountTokensKey is the volume context key of the service account
+// tokens passed to the driver on NodePublishVolume
+const serviceAccountTokensKey = "csi.storage.k8s.io/serviceAccount.tokens"
+
 func ParseEndpoint(ep string) (string, string, error) {
 	if strings.HasPrefix(strings.ToLower(ep), "unix://") || strings.HasPrefix(strings.ToLower(ep), "tcp://") {
 		s := strings.SplitN(ep, "://", 2)
@@ -120,5 +124,14 @@ func logRedactedRequest(req interface{}) {
 		redactedSecrets[k] = "[REDACTED]"
 	}
 	req1.Secrets = redactedSecrets
+
+	if _, ok := req1.GetVolumeContext()[serviceAccountTokensKey]; ok {
+		volumeContext := make(map[string]string, len(req1.GetVolumeContext()))
+		for k, v := range req1.GetVolumeContext() {
+			volumeContext[k] = v
+		}
+		volumeContext[serviceAccountTokensKey] = "[REDACTED]"
+		req1.VolumeContext = volumeContext
+	}
 	log.Debugf("GRPC request: %+v", req1)
 }
@@ -17,8 +17,11 @@ limitations under the License.
 package csicommon
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -74,3 +77,30 @@ func TestParseEndpoint(t *testing.T) {
 	_, _, err = ParseEndpoint("")
 	assert.NotNil(t, err)
 }
+
+func TestLogRedactedRequest(t *testing.T) {
+	var buf bytes.Buffer
+	out, level := log.StandardLogger().Out, log.GetLevel()
+	log.SetOutput(&buf)
+	log.SetLevel(log.DebugLevel)
+	defer func() {
+		log.SetOutput(out)
+		log.SetLevel(level)
+	}()
+
+	volumeContext := map[string]string{
+		"secretProviderClass":   "spc1",
+		serviceAccountTokensKey: `{"aud":{"token":"sa-token"}}`,
+	}
+	logRedactedRequest(&csi.NodePublishVolumeRequest{
+		VolumeId:      "vol1",
+		Secrets:       map[string]string{"key": "node-publish-secret"},
+		VolumeContext: volumeContext,
+	})
+
+	assert.Contains(t, buf.String(), "spc1")
+	assert.NotContains(t, buf.String(), "sa-token")
+	assert.NotContains(t, buf.String(), "node-publish-secret")
+	// the request itself is left untouched
+	assert.Equal(t, `{"aud":{"token":"sa-token"}}`, volumeContext[serviceAccountTokensKey])
+}
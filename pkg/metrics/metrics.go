@@ -0,0 +1,204 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	metricsNamespace = "secrets_store"
+
+	providerLabel  = "provider"
+	namespaceLabel = "namespace"
+	statusLabel    = "status"
+
+	// ProviderCallSuccess is the status of a successful provider call
+	ProviderCallSuccess = "success"
+	// ProviderCallError is the status of a failed provider call
+	ProviderCallError = "error"
+	// ProviderCallTimeout is the status of a provider call that didn't
+	// complete within the provider timeout
+	ProviderCallTimeout = "timeout"
+
+	// RotationRotated is the status of a rotation that updated the content
+	RotationRotated = "rotated"
+	// RotationUnchanged is the status of a rotation that found the mounted
+	// content up to date
+	RotationUnchanged = "unchanged"
+	// RotationError is the status of a failed rotation
+	RotationError = "error"
+
+	verificationVerified = "verified"
+	verificationRefused  = "refused"
+
+	syncSuccess = "success"
+	syncError   = "error"
+)
+
+// The metrics are labelled by provider and pod namespace only. Secret names,
+// object names and contents must never be used as label values.
+var (
+	nodePublishTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "node_publish_total",
+			Help:      "Total number of NodePublishVolume requests by gRPC status code",
+		},
+		[]string{providerLabel, namespaceLabel, statusLabel},
+	)
+	nodePublishDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "node_publish_duration_seconds",
+			Help:      "Duration of NodePublishVolume requests in seconds",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		},
+		[]string{providerLabel, statusLabel},
+	)
+	nodeUnpublishTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "node_unpublish_total",
+			Help:      "Total number of NodeUnpublishVolume requests by gRPC status code",
+		},
+		[]string{providerLabel, namespaceLabel, statusLabel},
+	)
+	nodeUnpublishDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "node_unpublish_duration_seconds",
+			Help:      "Duration of NodeUnpublishVolume requests in seconds",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		},
+		[]string{providerLabel, statusLabel},
+	)
+	providerCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "provider_call_duration_seconds",
+			Help:      "Duration of provider calls mounting the secrets store objects in seconds by exit status",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		},
+		[]string{providerLabel, statusLabel},
+	)
+	providerVerificationTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "provider_verification_total",
+			Help:      "Total number of provider binary verifications by result",
+		},
+		[]string{providerLabel, statusLabel},
+	)
+	k8sSecretSyncTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "k8s_secret_sync_total",
+			Help:      "Total number of syncs of the mounted content to K8s secrets",
+		},
+		[]string{providerLabel, namespaceLabel, statusLabel},
+	)
+	rotationTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rotation_total",
+			Help:      "Total number of rotations of the mounted content by result",
+		},
+		[]string{providerLabel, namespaceLabel, statusLabel},
+	)
+
+	registry = prometheus.NewRegistry()
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		nodePublishTotal,
+		nodePublishDuration,
+		nodeUnpublishTotal,
+		nodeUnpublishDuration,
+		providerCallDuration,
+		providerVerificationTotal,
+		k8sSecretSyncTotal,
+		rotationTotal,
+	)
+}
+
+// Handler returns the handler serving the driver metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the driver metrics on /metrics at addr. It blocks until the
+// server fails.
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// ReportNodePublish records the outcome and latency of a NodePublishVolume
+// request
+func ReportNodePublish(provider, namespace string, err error, duration time.Duration) {
+	code := status.Code(err).String()
+	nodePublishTotal.WithLabelValues(provider, namespace, code).Inc()
+	nodePublishDuration.WithLabelValues(provider, code).Observe(duration.Seconds())
+}
+
+// ReportNodeUnpublish records the outcome and latency of a
+// NodeUnpublishVolume request
+func ReportNodeUnpublish(provider, namespace string, err error, duration time.Duration) {
+	code := status.Code(err).String()
+	nodeUnpublishTotal.WithLabelValues(provider, namespace, code).Inc()
+	nodeUnpublishDuration.WithLabelValues(provider, code).Observe(duration.Seconds())
+}
+
+// ReportProviderCall records the exit status and duration of a provider call
+func ReportProviderCall(provider, exitStatus string, duration time.Duration) {
+	providerCallDuration.WithLabelValues(provider, exitStatus).Observe(duration.Seconds())
+}
+
+// ReportProviderVerification records the result of verifying a provider
+// binary before it's executed
+func ReportProviderVerification(provider string, err error) {
+	result := verificationVerified
+	if err != nil {
+		result = verificationRefused
+	}
+	providerVerificationTotal.WithLabelValues(provider, result).Inc()
+}
+
+// ReportK8sSecretSync records the outcome of syncing the mounted content to
+// K8s secrets
+func ReportK8sSecretSync(provider, namespace string, err error) {
+	result := syncSuccess
+	if err != nil {
+		result = syncError
+	}
+	k8sSecretSyncTotal.WithLabelValues(provider, namespace, result).Inc()
+}
+
+// ReportRotation records the result of rotating the content of a volume
+func ReportRotation(provider, namespace, result string) {
+	rotationTotal.WithLabelValues(provider, namespace, result).Inc()
+}
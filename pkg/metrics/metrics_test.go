@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReportNodePublish(t *testing.T) {
+	ReportNodePublish("provider1", "default", nil, time.Second)
+	ReportNodePublish("provider1", "default", status.Error(codes.InvalidArgument, "invalid"), time.Second)
+	ReportNodePublish("provider1", "default", errors.New("failed"), time.Second)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(nodePublishTotal.WithLabelValues("provider1", "default", "OK")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(nodePublishTotal.WithLabelValues("provider1", "default", "InvalidArgument")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(nodePublishTotal.WithLabelValues("provider1", "default", "Unknown")))
+}
+
+func TestReportK8sSecretSync(t *testing.T) {
+	ReportK8sSecretSync("provider1", "default", nil)
+	ReportK8sSecretSync("provider1", "default", errors.New("failed"))
+	ReportK8sSecretSync("provider1", "default", errors.New("failed"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(k8sSecretSyncTotal.WithLabelValues("provider1", "default", syncSuccess)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(k8sSecretSyncTotal.WithLabelValues("provider1", "default", syncError)))
+}
+
+func TestReportProviderVerification(t *testing.T) {
+	ReportProviderVerification("provider1", nil)
+	ReportProviderVerification("provider1", errors.New("digest not allowed"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(providerVerificationTotal.WithLabelValues("provider1", verificationVerified)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(providerVerificationTotal.WithLabelValues("provider1", verificationRefused)))
+}
+
+func TestHandler(t *testing.T) {
+	ReportProviderCall("provider1", ProviderCallTimeout, time.Minute)
+	ReportRotation("provider1", "default", RotationRotated)
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.Contains(string(body), `secrets_store_provider_call_duration_seconds_count{provider="provider1",status="timeout"} 1`))
+	assert.True(t, strings.Contains(string(body), `secrets_store_rotation_total{namespace="default",provider="provider1",status="rotated"} 1`))
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+// newKubeClients returns a client reading from and writing to the API server
+// and a reader serving secretproviderclass objects from informer caches. The
+// clients share a single REST mapper and are meant to live as long as the
+// driver. The informer caches run until they're no longer used or stopCh is
+// closed.
+func newKubeClients(stopCh <-chan struct{}) (client.Client, client.Reader, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	mapper, err := apiutil.NewDiscoveryRESTMapper(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme, Mapper: mapper})
+	if err != nil {
+		return nil, nil, err
+	}
+	caches := newNamespacedCache(func(namespace string, stopCh <-chan struct{}) (client.Reader, error) {
+		return newSecretProviderClassCache(cfg, mapper, namespace, stopCh)
+	})
+	go func() {
+		<-stopCh
+		caches.stopUnused(nil)
+	}()
+	return c, &cachedReader{cache: caches, client: c}, nil
+}
+
+// newSecretProviderClassCache starts an informer cache of the
+// secretproviderclass objects in the namespace
+func newSecretProviderClassCache(cfg *rest.Config, mapper meta.RESTMapper, namespace string, stopCh <-chan struct{}) (cache.Cache, error) {
+	informerCache, err := cache.New(cfg, cache.Options{Scheme: scheme, Mapper: mapper, Namespace: namespace})
+	if err != nil {
+		return nil, err
+	}
+	// only secretproviderclass objects are read from the cache, register the
+	// informer before the cache is started so it's synced along with it
+	if _, err := informerCache.GetInformer(&spcv1alpha1.SecretProviderClass{}); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := informerCache.Start(stopCh); err != nil {
+			log.Errorf("failed to start secretproviderclass informer cache for ns: %s, err: %v", namespace, err)
+		}
+	}()
+	go func() {
+		if informerCache.WaitForCacheSync(stopCh) {
+			log.Infof("secretproviderclass informer cache synced for ns: %s", namespace)
+		}
+	}()
+	return informerCache, nil
+}
+
+// namespacedCache reads objects from caches scoped to a single namespace. The
+// cache of a namespace is created the first time an object of the namespace
+// is read, so a node only watches the namespaces of the pods mounting volumes
+// on it and the shared secretproviderclass namespace instead of every
+// secretproviderclass object in the cluster. The cache of a namespace is
+// stopped with stopUnused once no volume uses it.
+type namespacedCache struct {
+	newCache func(namespace string, stopCh <-chan struct{}) (client.Reader, error)
+
+	lock   sync.Mutex
+	caches map[string]*namespaceCache
+}
+
+// namespaceCache is the cache of a namespace and the channel stopping it
+type namespaceCache struct {
+	reader client.Reader
+	stopCh chan struct{}
+}
+
+var _ client.Reader = &namespacedCache{}
+
+func newNamespacedCache(newCache func(namespace string, stopCh <-chan struct{}) (client.Reader, error)) *namespacedCache {
+	return &namespacedCache{
+		newCache: newCache,
+		caches:   make(map[string]*namespaceCache),
+	}
+}
+
+// cacheFor returns the cache of the namespace, creating it if needed
+func (c *namespacedCache) cacheFor(namespace string) (client.Reader, error) {
+	if len(namespace) == 0 {
+		return nil, fmt.Errorf("reading objects in all namespaces is not supported")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cache, ok := c.caches[namespace]; ok {
+		return cache.reader, nil
+	}
+	stopCh := make(chan struct{})
+	reader, err := c.newCache(namespace, stopCh)
+	if err != nil {
+		close(stopCh)
+		return nil, err
+	}
+	c.caches[namespace] = &namespaceCache{reader: reader, stopCh: stopCh}
+	return reader, nil
+}
+
+// stopUnused stops the caches of the namespaces that aren't in use. A read
+// in a namespace after its cache was stopped starts a new cache.
+func (c *namespacedCache) stopUnused(inUse map[string]bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for namespace, cache := range c.caches {
+		if inUse[namespace] {
+			continue
+		}
+		log.Infof("stopping secretproviderclass informer cache for ns: %s", namespace)
+		close(cache.stopCh)
+		delete(c.caches, namespace)
+	}
+}
+
+// Get retrieves the object from the cache of its namespace
+func (c *namespacedCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	namespaceCache, err := c.cacheFor(key.Namespace)
+	if err != nil {
+		return err
+	}
+	return namespaceCache.Get(ctx, key, obj)
+}
+
+// List retrieves the list of objects from the cache of the namespace set with
+// client.InNamespace
+func (c *namespacedCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	namespaceCache, err := c.cacheFor(listOpts.Namespace)
+	if err != nil {
+		return err
+	}
+	return namespaceCache.List(ctx, list, opts...)
+}
+
+// cachedReader reads objects from the informer cache. Objects not found in
+// the cache, e.g. because they were created right before the pod or the cache
+// hasn't synced yet, are read from the API server.
+type cachedReader struct {
+	cache  client.Reader
+	client client.Reader
+}
+
+var _ client.Reader = &cachedReader{}
+
+// Get retrieves the object from the cache, falling back to the API server
+// if it's not found
+func (r *cachedReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	err := r.cache.Get(ctx, key, obj)
+	if errors.IsNotFound(err) {
+		log.Debugf("object %s not found in cache, reading from the API server", key)
+		return r.client.Get(ctx, key, obj)
+	}
+	return err
+}
+
+// List retrieves the list of objects from the cache
+func (r *cachedReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return r.cache.List(ctx, list, opts...)
+}
+
+// stopUnused stops the caches of the namespaces that aren't in use, if the
+// cache is a namespaced cache
+func (r *cachedReader) stopUnused(inUse map[string]bool) {
+	if caches, ok := r.cache.(*namespacedCache); ok {
+		caches.stopUnused(inUse)
+	}
+}
+
+// unavailableClient fails every request with the error creating the
+// kubernetes clients. The driver uses it when it runs without access to a
+// cluster, e.g. in the sanity tests, so it still serves the volumes that don't
+// need the API server.
+type unavailableClient struct {
+	err error
+}
+
+var _ client.Client = &unavailableClient{}
+
+func (c *unavailableClient) unavailable() error {
+	return status.Errorf(codes.Unavailable, "kubernetes client is not available, err: %v", c.err)
+}
+
+func (c *unavailableClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) DeleteAllOf(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	return c.unavailable()
+}
+
+func (c *unavailableClient) Status() client.StatusWriter {
+	return c
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func TestCachedReader(t *testing.T) {
+	cached := &spcv1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "cached", Namespace: "default"},
+		Spec:       spcv1alpha1.SecretProviderClassSpec{Provider: "provider1"},
+	}
+	// the API server has a newer version of the cached object
+	updated := cached.DeepCopy()
+	updated.Spec.Provider = "provider2"
+	created := &spcv1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: "default"},
+		Spec:       spcv1alpha1.SecretProviderClassSpec{Provider: "provider1"},
+	}
+	reader := &cachedReader{
+		cache:  fake.NewFakeClientWithScheme(scheme, cached),
+		client: fake.NewFakeClientWithScheme(scheme, updated, created),
+	}
+	ctx := context.Background()
+
+	spc := &spcv1alpha1.SecretProviderClass{}
+	err := reader.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cached"}, spc)
+	assert.NoError(t, err)
+	assert.Equal(t, spcv1alpha1.Provider("provider1"), spc.Spec.Provider)
+
+	// objects not in the cache yet are read from the API server
+	err = reader.Get(ctx, types.NamespacedName{Namespace: "default", Name: "created"}, spc)
+	assert.NoError(t, err)
+	assert.Equal(t, "created", spc.Name)
+
+	err = reader.Get(ctx, types.NamespacedName{Namespace: "default", Name: "missing"}, spc)
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestNamespacedCache(t *testing.T) {
+	objects := map[string]*spcv1alpha1.SecretProviderClass{
+		"default": {ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"}},
+		"shared":  {ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "shared"}},
+	}
+	var created []string
+	stopChs := make(map[string]<-chan struct{})
+	c := newNamespacedCache(func(namespace string, stopCh <-chan struct{}) (client.Reader, error) {
+		created = append(created, namespace)
+		stopChs[namespace] = stopCh
+		// the cache of a namespace only serves the objects of the namespace
+		return fake.NewFakeClientWithScheme(scheme, objects[namespace]), nil
+	})
+	ctx := context.Background()
+
+	spc := &spcv1alpha1.SecretProviderClass{}
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "spc1"}, spc))
+	assert.Equal(t, "default", spc.Namespace)
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "spc1"}, spc))
+	list := &spcv1alpha1.SecretProviderClassList{}
+	assert.NoError(t, c.List(ctx, list, client.InNamespace("shared")))
+	assert.Len(t, list.Items, 1)
+	assert.Equal(t, []string{"default", "shared"}, created)
+
+	assert.Error(t, c.List(ctx, list))
+
+	// the caches of namespaces that aren't in use are stopped and created
+	// again when they're read
+	c.stopUnused(map[string]bool{"shared": true})
+	assert.True(t, isClosed(stopChs["default"]))
+	assert.False(t, isClosed(stopChs["shared"]))
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "spc1"}, spc))
+	assert.Equal(t, []string{"default", "shared", "default"}, created)
+	assert.False(t, isClosed(stopChs["default"]))
+}
+
+func TestRemoveVolumeStopsUnusedCaches(t *testing.T) {
+	stopChs := make(map[string]<-chan struct{})
+	caches := newNamespacedCache(func(namespace string, stopCh <-chan struct{}) (client.Reader, error) {
+		stopChs[namespace] = stopCh
+		return fake.NewFakeClientWithScheme(scheme), nil
+	})
+	ns := &nodeServer{
+		reader:  &cachedReader{cache: caches, client: fake.NewFakeClientWithScheme(scheme)},
+		volumes: newPublishedVolumes(),
+	}
+	ns.volumes.add(publishedVolume{TargetPath: "/target1", PodNamespace: "default", SecretProviderClassNamespace: "shared"})
+	ns.volumes.add(publishedVolume{TargetPath: "/target2", PodNamespace: "other", SecretProviderClassNamespace: "other"})
+	for _, namespace := range []string{"default", "shared", "other"} {
+		_, err := caches.cacheFor(namespace)
+		assert.NoError(t, err)
+	}
+
+	ns.removeVolume("/target2")
+	assert.True(t, isClosed(stopChs["other"]))
+	assert.False(t, isClosed(stopChs["default"]))
+	assert.False(t, isClosed(stopChs["shared"]))
+
+	ns.removeVolume("/target1")
+	assert.True(t, isClosed(stopChs["default"]))
+	assert.True(t, isClosed(stopChs["shared"]))
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestUnavailableClient(t *testing.T) {
+	c := &unavailableClient{err: fmt.Errorf("could not locate a kubeconfig")}
+	ctx := context.Background()
+
+	err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "spc1"}, &spcv1alpha1.SecretProviderClass{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	err = c.Status().Update(ctx, &spcv1alpha1.SecretProviderClassPodStatus{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
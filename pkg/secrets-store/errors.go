@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+const (
+	// providerResourceType and secretProviderClassResourceType are the
+	// resource types of the google.rpc.ResourceInfo error details
+	providerResourceType            = "provider"
+	secretProviderClassResourceType = "secrets-store.csi.x-k8s.io/SecretProviderClass"
+	// redacted replaces the secrets of a volume in provider errors
+	redacted = "[REDACTED]"
+)
+
+// incompatibleProviderError is returned when the provider version isn't one
+// of the versions compatible with the driver or the driver version is older
+// than the minimum driver version the provider works with
+type incompatibleProviderError struct {
+	providerName     string
+	providerVersions string
+	minDriverVersion string
+}
+
+func (e *incompatibleProviderError) Error() string {
+	if e.minDriverVersion != "" {
+		return fmt.Sprintf("Minimum supported driver version with %s provider is %s, current driver version is %s", e.providerName, e.minDriverVersion, vendorVersion)
+	}
+	if version.IsVersionRange(e.providerVersions) {
+		return fmt.Sprintf("Supported %s provider versions with current driver are %s", e.providerName, e.providerVersions)
+	}
+	return fmt.Sprintf("Minimum supported %s provider version with current driver is %s", e.providerName, e.providerVersions)
+}
+
+// GRPCStatus returns the error as a FailedPrecondition gRPC status
+func (e *incompatibleProviderError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// foreignSecretError is returned when a K8s secret to sync already exists and
+// isn't managed by the driver
+type foreignSecretError struct {
+	name      string
+	namespace string
+}
+
+func (e *foreignSecretError) Error() string {
+	return fmt.Sprintf("secret %s/%s exists and is not managed by the driver, set the %s=true annotation on the secret to let the driver adopt it", e.namespace, e.name, spcv1alpha1.AdoptAnnotation)
+}
+
+// GRPCStatus returns the error as an AlreadyExists gRPC status
+func (e *foreignSecretError) GRPCStatus() *status.Status {
+	return status.New(codes.AlreadyExists, e.Error())
+}
+
+// withErrorDetails returns err as a gRPC status error with the provider and
+// the secretproviderclass the volume is published with, if known, attached as
+// google.rpc.ResourceInfo error details. Errors that aren't gRPC status errors
+// are returned as Internal errors.
+func withErrorDetails(err error, providerName, secretProviderClass, namespace string) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		st = status.New(codes.Internal, err.Error())
+	}
+
+	var details []proto.Message
+	if len(providerName) > 0 {
+		details = append(details, &errdetails.ResourceInfo{
+			ResourceType: providerResourceType,
+			ResourceName: providerName,
+		})
+	}
+	if len(secretProviderClass) > 0 {
+		details = append(details, &errdetails.ResourceInfo{
+			ResourceType: secretProviderClassResourceType,
+			ResourceName: fmt.Sprintf("%s/%s", namespace, secretProviderClass),
+		})
+	}
+	if len(details) == 0 {
+		return st.Err()
+	}
+	stWithDetails, detailsErr := st.WithDetails(details...)
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return stWithDetails.Err()
+}
+
+// providerErrorCode returns the code of an error calling a provider. Errors
+// returned by providers without a gRPC status, e.g. a failed provider binary,
+// are reported as Unavailable so the call is retried.
+func providerErrorCode(err error) codes.Code {
+	if code := status.Code(err); code != codes.Unknown {
+		return code
+	}
+	return codes.Unavailable
+}
+
+// redactSecrets returns the error of a provider call with the secrets of the
+// volume, e.g. echoed in the provider output, redacted
+func redactSecrets(err error, secrets []string) error {
+	if _, ok := err.(*incompatibleProviderError); ok {
+		return err
+	}
+	st := status.Convert(err)
+	message := st.Message()
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			message = strings.Replace(message, secret, redacted, -1)
+		}
+	}
+	return status.Error(st.Code(), message)
+}
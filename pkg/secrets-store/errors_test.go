@@ -0,0 +1,233 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func TestWithErrorDetails(t *testing.T) {
+	err := withErrorDetails(status.Error(codes.NotFound, "not found"), "provider1", "spc1", "ns1")
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "not found", st.Message())
+	assert.Equal(t, []interface{}{
+		&errdetails.ResourceInfo{ResourceType: providerResourceType, ResourceName: "provider1"},
+		&errdetails.ResourceInfo{ResourceType: secretProviderClassResourceType, ResourceName: "ns1/spc1"},
+	}, st.Details())
+
+	// errors without a status are internal errors
+	err = withErrorDetails(errors.New("failed"), "", "", "")
+	st = status.Convert(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.Equal(t, "failed", st.Message())
+	assert.Empty(t, st.Details())
+}
+
+func TestRedactSecrets(t *testing.T) {
+	secrets := []string{"id", "s3cr3t", ""}
+
+	err := redactSecrets(status.Error(codes.Unavailable, "failed to login with id and s3cr3t"), secrets)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "failed to login with [REDACTED] and [REDACTED]", status.Convert(err).Message())
+
+	incompatible := &incompatibleProviderError{providerName: "provider1", providerVersions: "0.0.9"}
+	assert.Equal(t, incompatible, redactSecrets(incompatible, secrets))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(incompatible))
+}
+
+func TestNodePublishVolumeErrors(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+
+	oldProvider := newFakeProviderServer(t, filepath.Join(providerDir, "oldprovider.sock"), &fakeProviderServer{})
+	defer oldProvider.Stop()
+	failingProvider := newFakeProviderServer(t, filepath.Join(providerDir, "failingprovider.sock"), &fakeProviderServer{errorCode: "AccessDenied"})
+	defer failingProvider.Stop()
+	newProvider := newFakeProviderServer(t, filepath.Join(providerDir, "newprovider.sock"), &fakeProviderServer{minDriverVersion: "v1.0.0"})
+	defer newProvider.Stop()
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir, MinProviderVersions: "oldprovider=0.0.9"}, nil, fake.NewFakeClientWithScheme(scheme), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	ns.mounter = &mount.FakeMounter{}
+
+	// the unverified provider binary doesn't match the allowed digest
+	if err := os.MkdirAll(filepath.Join(providerDir, "unverifiedprovider"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(providerDir, "unverifiedprovider", "provider-unverifiedprovider"), []byte("provider"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	ns.providerVerifier, err = newProviderVerifier("unverifiedprovider=sha256:"+strings.Repeat("0", 64), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(ns.providerVerifier.dir)
+
+	cases := []struct {
+		desc          string
+		volumeContext map[string]string
+		expectedCode  codes.Code
+		expectedInfo  *errdetails.ResourceInfo
+	}{
+		{
+			desc:          "secretproviderclass not set",
+			volumeContext: map[string]string{csipodnamespace: "default"},
+			expectedCode:  codes.InvalidArgument,
+		},
+		{
+			desc:          "secretproviderclass not found",
+			volumeContext: map[string]string{secretProviderClassField: "spc1", csipodnamespace: "default"},
+			expectedCode:  codes.NotFound,
+			expectedInfo:  &errdetails.ResourceInfo{ResourceType: secretProviderClassResourceType, ResourceName: "default/spc1"},
+		},
+		{
+			desc:          "provider binary not found",
+			volumeContext: map[string]string{"providerName": "missingprovider", csipodnamespace: "default"},
+			expectedCode:  codes.NotFound,
+			expectedInfo:  &errdetails.ResourceInfo{ResourceType: providerResourceType, ResourceName: "missingprovider"},
+		},
+		{
+			desc:          "provider binary failed verification",
+			volumeContext: map[string]string{"providerName": "unverifiedprovider", csipodnamespace: "default"},
+			expectedCode:  codes.PermissionDenied,
+			expectedInfo:  &errdetails.ResourceInfo{ResourceType: providerResourceType, ResourceName: "unverifiedprovider"},
+		},
+		{
+			desc:          "incompatible provider version",
+			volumeContext: map[string]string{"providerName": "oldprovider", csipodnamespace: "default"},
+			expectedCode:  codes.FailedPrecondition,
+			expectedInfo:  &errdetails.ResourceInfo{ResourceType: providerResourceType, ResourceName: "oldprovider"},
+		},
+		{
+			desc:          "driver older than the minimum driver version of the provider",
+			volumeContext: map[string]string{"providerName": "newprovider", csipodnamespace: "default"},
+			expectedCode:  codes.FailedPrecondition,
+			expectedInfo:  &errdetails.ResourceInfo{ResourceType: providerResourceType, ResourceName: "newprovider"},
+		},
+		{
+			desc:          "provider failed to mount objects",
+			volumeContext: map[string]string{"providerName": "failingprovider", csipodnamespace: "default"},
+			expectedCode:  codes.Unavailable,
+			expectedInfo:  &errdetails.ResourceInfo{ResourceType: providerResourceType, ResourceName: "failingprovider"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			targetPath, err := ioutil.TempDir("", "target")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(targetPath)
+
+			_, err = ns.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				VolumeId:   "vol1",
+				TargetPath: targetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				},
+				Readonly:      true,
+				VolumeContext: tc.volumeContext,
+			})
+			st := status.Convert(err)
+			assert.Equal(t, tc.expectedCode, st.Code())
+			if tc.expectedInfo != nil {
+				assert.Contains(t, st.Details(), tc.expectedInfo)
+			}
+		})
+	}
+}
+
+func TestNodePublishVolumeCleanup(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	server := newFakeProviderServer(t, filepath.Join(providerDir, "fakeprovider.sock"), &fakeProviderServer{})
+	defer server.Stop()
+
+	spc := &spcv1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec:       spcv1alpha1.SecretProviderClassSpec{Provider: "fakeprovider", Parameters: map[string]string{"objects": "object1"}},
+	}
+	// the secretproviderclasspodstatus object can't be created
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir}, &unavailableClient{err: errors.New("unavailable")}, fake.NewFakeClientWithScheme(scheme, spc), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	mounter := &mount.FakeMounter{}
+	ns.mounter = mounter
+
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:         "csi-vol1",
+		TargetPath:       targetPath,
+		VolumeCapability: &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}},
+		Readonly:         true,
+		VolumeContext: map[string]string{
+			secretProviderClassField: "spc1",
+			csipodname:               "pod1",
+			csipodnamespace:          "default",
+			csipoduid:                "uid1",
+		},
+	}
+	_, err = ns.NodePublishVolume(context.Background(), req)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	// the target path is unmounted so the retry publishes the volume again
+	assert.Empty(t, mounter.MountPoints)
+	_, ok := ns.volumes.get(targetPath)
+	assert.False(t, ok)
+
+	ns.client = fake.NewFakeClientWithScheme(scheme)
+	_, err = ns.NodePublishVolume(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Len(t, mounter.MountPoints, 1)
+	err = ns.client.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "csi-vol1")}, &spcv1alpha1.SecretProviderClassPodStatus{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+const (
+	// reasons of the events recorded on the pod and the secretproviderclass
+	// of a volume
+	providerErrorReason        = "ProviderError"
+	incompatibleProviderReason = "IncompatibleProvider"
+	providerVerificationReason = "ProviderVerificationFailed"
+	objectNotFoundReason       = "ObjectNotFound"
+	secretRotatedReason        = "SecretRotated"
+	foreignSecretReason        = "ForeignSecret"
+	contentSecretErrorReason   = "ContentSecretError"
+)
+
+// newEventRecorder returns a recorder for the events of the volumes
+// published on the node
+func newEventRecorder(driverName, nodeID string) (record.EventRecorder, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme, corev1.EventSource{Component: driverName, Host: nodeID}), nil
+}
+
+// eventObjects returns the objects the events of a volume are recorded on:
+// the pod consuming the volume and the secretproviderclass, if set
+func eventObjects(podName, podNamespace, podUID, secretProviderClass, secretProviderClassNamespace string) []*corev1.ObjectReference {
+	var objects []*corev1.ObjectReference
+	if len(podName) > 0 {
+		objects = append(objects, &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       podName,
+			Namespace:  podNamespace,
+			UID:        types.UID(podUID),
+		})
+	}
+	if len(secretProviderClass) > 0 {
+		objects = append(objects, &corev1.ObjectReference{
+			APIVersion: spcv1alpha1.GroupVersion.String(),
+			Kind:       "SecretProviderClass",
+			Name:       secretProviderClass,
+			Namespace:  secretProviderClassNamespace,
+		})
+	}
+	return objects
+}
+
+// eventRecorder records the events of volumes on their pod and
+// secretproviderclass. Events aren't recorded without a recorder.
+type eventRecorder struct {
+	recorder record.EventRecorder
+}
+
+// recordEvent records the event on all objects
+func (r eventRecorder) recordEvent(objects []*corev1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.recorder == nil {
+		return
+	}
+	for _, obj := range objects {
+		r.recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+	}
+}
+
+// recordProviderError records a provider failing to mount the secrets store
+// objects. The error must not contain the secrets of the volume.
+func (ns *nodeServer) recordProviderError(objects []*corev1.ObjectReference, providerName string, err error) {
+	reason := providerErrorReason
+	switch err.(type) {
+	case *incompatibleProviderError:
+		reason = incompatibleProviderReason
+	case *providerVerificationError:
+		reason = providerVerificationReason
+	}
+	ns.recordEvent(objects, corev1.EventTypeWarning, reason, "failed to mount secrets store objects with provider %s, err: %v", providerName, err)
+}
+
+// recordMissingObjects records the objects of the K8s secrets to sync that
+// weren't mounted by the provider
+func (r eventRecorder) recordMissingObjects(objects []*corev1.ObjectReference, contents map[string][]byte, secretObjects []spcv1alpha1.SecretObject) {
+	for _, secretObject := range secretObjects {
+		for _, secretObjectData := range secretObject.Data {
+			if _, found := contents[secretObjectData.ObjectName]; !found {
+				r.recordEvent(objects, corev1.EventTypeWarning, objectNotFoundReason, "file matching objectName %s not found, key %s of secret %s is not synced", secretObjectData.ObjectName, secretObjectData.Key, secretObject.SecretName)
+			}
+		}
+	}
+}
+
+// recordForeignSecret records a K8s secret the driver refused to sync because
+// it isn't managed by the driver
+func (r eventRecorder) recordForeignSecret(objects []*corev1.ObjectReference, err error) {
+	if _, ok := err.(*foreignSecretError); ok {
+		r.recordEvent(objects, corev1.EventTypeWarning, foreignSecretReason, "failed to sync secret, err: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func TestEventObjects(t *testing.T) {
+	objects := eventObjects("pod1", "ns1", "uid1", "spc1", "ns2")
+	assert.Equal(t, []*corev1.ObjectReference{
+		{APIVersion: "v1", Kind: "Pod", Name: "pod1", Namespace: "ns1", UID: "uid1"},
+		{APIVersion: "secrets-store.csi.x-k8s.io/v1alpha1", Kind: "SecretProviderClass", Name: "spc1", Namespace: "ns2"},
+	}, objects)
+
+	// the pod name isn't known without podInfoOnMount
+	assert.Empty(t, eventObjects("", "ns1", "", "", ""))
+}
+
+func TestRecordEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	ns := &nodeServer{eventRecorder: eventRecorder{recorder: recorder}}
+	objects := eventObjects("pod1", "ns1", "uid1", "spc1", "ns1")
+
+	ns.recordProviderError(objects, "provider1", errors.New("failed"))
+	assert.Equal(t, "Warning ProviderError failed to mount secrets store objects with provider provider1, err: failed", <-recorder.Events)
+	assert.Equal(t, "Warning ProviderError failed to mount secrets store objects with provider provider1, err: failed", <-recorder.Events)
+
+	ns.recordProviderError(objects[:1], "provider1", &incompatibleProviderError{providerName: "provider1", providerVersions: "0.0.9"})
+	assert.Equal(t, "Warning IncompatibleProvider failed to mount secrets store objects with provider provider1, err: Minimum supported provider1 provider version with current driver is 0.0.9", <-recorder.Events)
+
+	ns.recordProviderError(objects[:1], "provider1", &providerVerificationError{providerName: "provider1", reason: "invalid signature"})
+	assert.Equal(t, "Warning ProviderVerificationFailed failed to mount secrets store objects with provider provider1, err: provider provider1 failed verification: invalid signature", <-recorder.Events)
+
+	ns.recordMissingObjects(objects[:1], map[string][]byte{"object1": []byte("secret")}, []spcv1alpha1.SecretObject{
+		{
+			SecretName: "secret1",
+			Data: []spcv1alpha1.SecretObjectData{
+				{ObjectName: "object1", Key: "key1"},
+				{ObjectName: "object2", Key: "key2"},
+			},
+		},
+	})
+	assert.Equal(t, "Warning ObjectNotFound file matching objectName object2 not found, key key2 of secret secret1 is not synced", <-recorder.Events)
+
+	ns.recordForeignSecret(objects[:1], errors.New("failed"))
+	ns.recordForeignSecret(objects[:1], &foreignSecretError{name: "secret1", namespace: "ns1"})
+	assert.Equal(t, "Warning ForeignSecret failed to sync secret, err: secret ns1/secret1 exists and is not managed by the driver, set the secrets-store.csi.k8s.io/adopt=true annotation on the secret to let the driver adopt it", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+
+	// events aren't recorded without a recorder
+	ns = &nodeServer{}
+	ns.recordEvent(objects, corev1.EventTypeNormal, secretRotatedReason, "rotated")
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// csiVolumeDataFile is the file kubelet writes the driver name and volume
+	// handle of a CSI volume to, next to the volume's mount dir
+	csiVolumeDataFile = "vol_data.json"
+)
+
+// csiVolumeData is the content of the csiVolumeDataFile used by the driver
+type csiVolumeData struct {
+	DriverName string `json:"driverName"`
+}
+
+// runOrphanCleanup cleans up the orphaned volumes on startup and every
+// interval until stopCh is closed. In dry run mode, the orphaned volumes are
+// only reported.
+func (ns *nodeServer) runOrphanCleanup(interval time.Duration, dryRun bool, stopCh <-chan struct{}) {
+	if runtime.GOOS == "windows" {
+		log.Warningf("orphaned volume cleanup is not supported on windows")
+		return
+	}
+	log.Infof("starting orphaned volume cleanup with interval %v, dry run: %t", interval, dryRun)
+	wait.Until(func() {
+		if err := ns.cleanupOrphanedVolumes(context.Background(), dryRun); err != nil {
+			log.Errorf("failed to clean up orphaned volumes, err: %v", err)
+		}
+	}, interval, stopCh)
+}
+
+// cleanupOrphanedVolumes unmounts the volumes of the driver on the node whose
+// pod no longer exists and deletes their K8s objects. Volumes are orphaned if
+// the driver wasn't running when kubelet tore down the pod.
+func (ns *nodeServer) cleanupOrphanedVolumes(ctx context.Context, dryRun bool) error {
+	// the mounts and tracked volumes must be listed before the pods, so a
+	// volume published while listing belongs to a pod in the list
+	mountPoints, err := ns.mounter.List()
+	if err != nil {
+		return err
+	}
+	vols := ns.volumes.list()
+
+	pods := &corev1.PodList{}
+	if err := ns.client.List(ctx, pods, client.MatchingField("spec.nodeName", ns.nodeID)); err != nil {
+		return err
+	}
+	// the driver pod itself runs on the node, no pods means the node ID
+	// doesn't match the node name and every volume would be orphaned
+	if len(pods.Items) == 0 {
+		log.Warningf("no pods found on node %s, skip cleaning up orphaned volumes", ns.nodeID)
+		return nil
+	}
+	podUIDs := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		podUIDs[string(pod.UID)] = true
+	}
+
+	orphans := make(map[string]string)
+	for _, mp := range mountPoints {
+		if !ns.isDriverMount(mp.Path) {
+			continue
+		}
+		podUID := getPodUIDFromTargetPath(runtime.GOOS, mp.Path)
+		if len(podUID) > 0 && !podUIDs[podUID] {
+			orphans[mp.Path] = podUID
+		}
+	}
+	// volumes unmounted without the driver being called are only tracked
+	for _, vol := range vols {
+		if !podUIDs[vol.PodUID] {
+			orphans[vol.TargetPath] = vol.PodUID
+		}
+	}
+
+	for targetPath, podUID := range orphans {
+		if dryRun {
+			log.Infof("[dry run] found orphaned volume at target path %s for pod: %s", targetPath, podUID)
+			continue
+		}
+		log.Infof("cleaning up orphaned volume at target path %s for pod: %s", targetPath, podUID)
+		if err := ns.cleanupOrphanedVolume(ctx, targetPath); err != nil {
+			log.Errorf("failed to clean up orphaned volume at target path %s, err: %v for pod: %s", targetPath, err, podUID)
+		}
+	}
+	return nil
+}
+
+// cleanupOrphanedVolume deletes the K8s objects of the volume published at
+// the target path, unmounts it and stops tracking it
+func (ns *nodeServer) cleanupOrphanedVolume(ctx context.Context, targetPath string) error {
+	if !ns.volumeLocks.tryAcquire(targetPath) {
+		return fmt.Errorf(volumeOperationAlreadyExistsFmt, targetPath)
+	}
+	defer ns.volumeLocks.release(targetPath)
+
+	podStatus, secretNames, err := ns.getPublishedK8sObjects(ctx, targetPath)
+	if err != nil {
+		return err
+	}
+	if podStatus != nil {
+		if err := removeK8sObjects(ctx, ns.client, podStatus, secretNames); err != nil {
+			return err
+		}
+	}
+	if err := mount.CleanupMountPoint(targetPath, ns.mounter, false); err != nil {
+		return err
+	}
+	ns.removeVolume(targetPath)
+	return nil
+}
+
+// isDriverMount returns true if the mount point is the target path of a CSI
+// volume published by the driver. Other CSI drivers can mount tmpfs in the
+// same location, so untracked volumes are checked with the volume data
+// written by kubelet.
+func (ns *nodeServer) isDriverMount(mountPath string) bool {
+	if !strings.Contains(mountPath, filepath.Join("volumes", "kubernetes.io~csi")) || filepath.Base(mountPath) != "mount" {
+		return false
+	}
+	if _, ok := ns.volumes.get(mountPath); ok {
+		return true
+	}
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(mountPath), csiVolumeDataFile))
+	if err != nil {
+		return false
+	}
+	var volData csiVolumeData
+	if err := json.Unmarshal(data, &volData); err != nil {
+		return false
+	}
+	return volData.DriverName == ns.Driver.GetName()
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func TestCleanupOrphanedVolumes(t *testing.T) {
+	ctx := context.Background()
+	runningPath := "/var/lib/kubelet/pods/uid1/volumes/kubernetes.io~csi/secrets-store-inline/mount"
+	orphanedPath := "/var/lib/kubelet/pods/uid2/volumes/kubernetes.io~csi/secrets-store-inline/mount"
+	foreignPath := "/var/lib/kubelet/pods/uid3/volumes/kubernetes.io~csi/other-driver/mount"
+	running := publishedVolume{VolumeID: "vol1", TargetPath: runningPath, PodName: "pod1", PodNamespace: "default", PodUID: "uid1", SecretProviderClass: "spc1", SecretProviderClassNamespace: "default", SecretNames: []string{"secret1"}}
+	orphaned := publishedVolume{VolumeID: "vol2", TargetPath: orphanedPath, PodName: "pod2", PodNamespace: "default", PodUID: "uid2", SecretProviderClass: "spc2", SecretProviderClassNamespace: "default", SecretNames: []string{"secret2"}}
+
+	newTestNodeServer := func() *nodeServer {
+		ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "node1"}, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ns.mounter = mount.NewFakeMounter([]mount.MountPoint{
+			{Path: runningPath, Type: "tmpfs"},
+			{Path: orphanedPath, Type: "tmpfs"},
+			{Path: foreignPath, Type: "tmpfs"},
+		})
+		ns.client = fake.NewFakeClientWithScheme(scheme,
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "default", UID: "uid1"}, Spec: corev1.PodSpec{NodeName: "node1"}},
+			newPodStatus(running, "node1"),
+			newPodStatus(orphaned, "node1"),
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret1", Namespace: "default", Labels: map[string]string{spcv1alpha1.ManagedLabel: "true"}}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret2", Namespace: "default", Labels: map[string]string{spcv1alpha1.ManagedLabel: "true"}}},
+		)
+		ns.volumes.add(running)
+		ns.volumes.add(orphaned)
+		return ns
+	}
+
+	// orphaned volumes are only reported in dry run mode
+	ns := newTestNodeServer()
+	err := ns.cleanupOrphanedVolumes(ctx, true)
+	assert.NoError(t, err)
+	assert.Len(t, ns.volumes.list(), 2)
+	err = ns.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret2"}, &corev1.Secret{})
+	assert.NoError(t, err)
+
+	ns = newTestNodeServer()
+	err = ns.cleanupOrphanedVolumes(ctx, false)
+	assert.NoError(t, err)
+	_, ok := ns.volumes.get(runningPath)
+	assert.True(t, ok)
+	_, ok = ns.volumes.get(orphanedPath)
+	assert.False(t, ok)
+
+	err = ns.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid2", "vol2")}, &spcv1alpha1.SecretProviderClassPodStatus{})
+	assert.True(t, errors.IsNotFound(err))
+	err = ns.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret2"}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+	err = ns.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "vol1")}, &spcv1alpha1.SecretProviderClassPodStatus{})
+	assert.NoError(t, err)
+	err = ns.client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret1"}, &corev1.Secret{})
+	assert.NoError(t, err)
+}
+
+func TestCleanupOrphanedVolumesWithoutPods(t *testing.T) {
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "node1"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.mounter = mount.NewFakeMounter(nil)
+	ns.client = fake.NewFakeClientWithScheme(scheme)
+	ns.volumes.add(publishedVolume{VolumeID: "vol1", TargetPath: "/var/lib/kubelet/pods/uid1/volumes/kubernetes.io~csi/secrets-store-inline/mount", PodUID: "uid1"})
+
+	// no pods on the node means the node ID is wrong, nothing is cleaned up
+	err = ns.cleanupOrphanedVolumes(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Len(t, ns.volumes.list(), 1)
+}
+
+func TestIsDriverMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "node1"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newVolume := func(name, volData string) string {
+		volumeDir := filepath.Join(dir, "uid1", "volumes", "kubernetes.io~csi", name)
+		if err := os.MkdirAll(filepath.Join(volumeDir, "mount"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if len(volData) > 0 {
+			if err := ioutil.WriteFile(filepath.Join(volumeDir, csiVolumeDataFile), []byte(volData), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return filepath.Join(volumeDir, "mount")
+	}
+
+	assert.True(t, ns.isDriverMount(newVolume("driver", `{"driverName":"`+ns.Driver.GetName()+`"}`)))
+	assert.False(t, ns.isDriverMount(newVolume("other-driver", `{"driverName":"other.csi.k8s.io"}`)))
+	assert.False(t, ns.isDriverMount(newVolume("no-volume-data", "")))
+	assert.False(t, ns.isDriverMount(filepath.Join(dir, "uid1", "volumes", "kubernetes.io~empty-dir", "data")))
+
+	tracked := newVolume("tracked", "")
+	ns.volumes.add(publishedVolume{TargetPath: tracked})
+	assert.True(t, ns.isDriverMount(tracked))
+}
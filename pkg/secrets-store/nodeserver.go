@@ -19,29 +19,70 @@ package secretsstore
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/jsonpb"
 
 	csicommon "sigs.k8s.io/secrets-store-csi-driver/pkg/csi-common"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/metrics"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/cmdutil"
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
 	version "sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
 	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type nodeServer struct {
 	*csicommon.DefaultNodeServer
 	providerVolumePath  string
 	minProviderVersions map[string]string
+	providerTimeout     time.Duration
+	providerTimeouts    map[string]time.Duration
 	mounter             mount.Interface
+	providerClients     *PluginClientBuilder
+	// providerVerifier verifies the provider binaries, if set
+	providerVerifier *providerVerifier
+	// providerInfos caches the versions and the capabilities of the
+	// provider binaries
+	providerInfos *providerInfoCache
+	// nodeID is the name of the node the driver is running on
+	nodeID string
+	// client reads from and writes to the API server
+	client client.Client
+	// reader reads secretproviderclass objects from the informer cache
+	reader client.Reader
+	// sharedSecretProviderClassNamespace is the namespace of the
+	// secretproviderclass objects shared by all namespaces, if any
+	sharedSecretProviderClassNamespace string
+	volumes                            *publishedVolumes
+	// volumeLocks serializes the operations on a target path
+	volumeLocks *volumeLocks
+	// eventRecorder records the events of a volume on the pod and the
+	// secretproviderclass
+	eventRecorder
+	// secretSyncMode is secretSyncModeController if the K8s secrets are
+	// synced by the secret sync controller from the content secrets written
+	// when volumes are published and rotated
+	secretSyncMode string
 }
 
 const (
@@ -49,18 +90,35 @@ const (
 	csipodname                           = "csi.storage.k8s.io/pod.name"
 	csipodnamespace                      = "csi.storage.k8s.io/pod.namespace"
 	csipoduid                            = "csi.storage.k8s.io/pod.uid"
-	providerField                        = "provider"
-	parametersField                      = "parameters"
+	csipodsa                             = "csi.storage.k8s.io/serviceAccount.name"
+	csipodsatokens                       = "csi.storage.k8s.io/serviceAccount.tokens"
 	secretProviderClassField             = "secretProviderClass"
+	// stagingDirPrefix is the prefix of the directory in the target path
+	// providers write the files to
+	stagingDirPrefix = "..staging_"
 )
 
-func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (_ *csi.NodePublishVolumeResponse, err error) {
 	var parameters map[string]string
 	var providerName string
-	var secretObjects []interface{}
+	var secretObjects []spcv1alpha1.SecretObject
 	var podNamespace, podUID string
+	var secretProviderClass, secretProviderClassNamespace string
 	syncK8sSecret := false
 
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			// the secretproviderclass is looked up in the pod namespace
+			// unless it's found in the shared namespace
+			if len(secretProviderClassNamespace) == 0 {
+				secretProviderClassNamespace = req.GetVolumeContext()[csipodnamespace]
+			}
+			err = withErrorDetails(err, providerName, secretProviderClass, secretProviderClassNamespace)
+		}
+		metrics.ReportNodePublish(providerName, req.GetVolumeContext()[csipodnamespace], err, time.Since(start))
+	}()
+
 	// Check arguments
 	if req.GetVolumeCapability() == nil {
 		return nil, status.Error(codes.InvalidArgument, "Volume capability missing in request")
@@ -78,6 +136,14 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	targetPath := req.GetTargetPath()
 	volumeID := req.GetVolumeId()
 	attrib := req.GetVolumeContext()
+
+	// kubelet can retry the request while the provider is still mounting
+	// the content, or unpublish the volume concurrently
+	if !ns.volumeLocks.tryAcquire(targetPath) {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, targetPath)
+	}
+	defer ns.volumeLocks.release(targetPath)
+
 	mountFlags := req.GetVolumeCapability().GetMount().GetMountFlags()
 	secrets := req.GetSecrets()
 
@@ -87,54 +153,71 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	}
 	if mnt {
 		log.Infof("NodePublishVolume: %s is already mounted", targetPath)
+		// kubelet republishes the volume with refreshed tokens if the
+		// CSIDriver requires republish
+		if tokens := attrib[csipodsatokens]; len(tokens) > 0 {
+			if _, err := parseServiceAccountTokens(tokens); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			ns.volumes.setServiceAccountTokens(targetPath, tokens)
+		}
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
 	log.Debugf("target %v, volumeId %v, attributes %v, mountflags %v",
-		targetPath, volumeID, attrib, mountFlags)
+		targetPath, volumeID, withoutServiceAccountTokens(attrib), mountFlags)
+
+	if _, err := parseServiceAccountTokens(attrib[csipodsatokens]); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
-	secretProviderClass := attrib[secretProviderClassField]
+	secretProviderClass = attrib[secretProviderClassField]
 	providerName = attrib["providerName"]
 	/// TODO: providerName is here for backward compatibility. Will eventually deprecate.
 	if secretProviderClass == "" && providerName == "" {
-		return nil, fmt.Errorf("secretProviderClass is not set")
+		return nil, status.Error(codes.InvalidArgument, "secretProviderClass is not set")
 	}
 
 	/// TODO: This is here for backward compatibility. Will eventually deprecate.
 	if providerName != "" {
 		parameters = attrib
 	} else {
-		item, err := getSecretProviderItemByName(ctx, secretProviderClass)
-		if err != nil {
-			return nil, err
-		}
-		provider, err := getStringFromObjectSpec(item.Object, providerField)
+		item, err := lookupSecretProviderClass(ctx, ns.reader, secretProviderClass, attrib[csipodnamespace], ns.sharedSecretProviderClassNamespace)
 		if err != nil {
+			log.Errorf("failed to get secretproviderclass %s, err: %v for pod: %s, ns: %s", secretProviderClass, err, attrib[csipoduid], attrib[csipodnamespace])
 			return nil, err
 		}
-		providerName = provider
-		parameters, err = getMapFromObjectSpec(item.Object, parametersField)
-		if err != nil {
-			return nil, err
+		secretProviderClassNamespace = item.GetNamespace()
+		if err := validateSecretProviderClass(item); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
+		providerName = string(item.Spec.Provider)
+		parameters = getParameters(item)
 		// [optional field]
-		secretObjects, syncK8sSecret, err = getSecretObjectsFromSpec(item)
-		if err != nil {
-			return nil, err
-		}
+		secretObjects = item.Spec.SecretObjects
+		syncK8sSecret = len(secretObjects) > 0
 		parameters[csipodname] = attrib[csipodname]
 		parameters[csipodnamespace] = attrib[csipodnamespace]
 		parameters[csipoduid] = attrib[csipoduid]
+		// providers authenticate as the pod with the service account tokens
+		if saName, ok := attrib[csipodsa]; ok {
+			parameters[csipodsa] = saName
+		}
+		if tokens, ok := attrib[csipodsatokens]; ok {
+			parameters[csipodsatokens] = tokens
+		}
 		podNamespace = parameters[csipodnamespace]
 		podUID = parameters[csipoduid]
 	}
 
+	events := eventObjects(attrib[csipodname], attrib[csipodnamespace], attrib[csipoduid], secretProviderClass, secretProviderClassNamespace)
+
 	if isMockProvider(providerName) {
 		// mock provider is used only for running sanity tests against the driver
 		err := ns.mounter.Mount("tmpfs", targetPath, "tmpfs", []string{})
 		if err != nil {
 			log.Errorf("mount err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
-			return nil, err
+			return nil, status.Errorf(codes.Internal, "failed to mount tmpfs at target path %s: %v", targetPath, err)
 		}
 		log.Infof("skipping calling provider as it's mock")
 	} else {
@@ -142,105 +225,442 @@ func (ns *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 		if !req.GetReadonly() {
 			return nil, status.Error(codes.InvalidArgument, "Readonly is not true in request")
 		}
-		// get provider volume path
-		providerVolumePath := ns.providerVolumePath
-		if providerVolumePath == "" {
-			return nil, fmt.Errorf("Providers volume path not found. Set PROVIDERS_VOLUME_PATH for pod: %s, ns: %s", podUID, podNamespace)
+		// mount before providers can write content to it
+		err = ns.mounter.Mount("tmpfs", targetPath, "tmpfs", []string{})
+		if err != nil {
+			log.Errorf("mount err: %v", err)
+			return nil, status.Errorf(codes.Internal, "failed to mount tmpfs at target path %s: %v", targetPath, err)
 		}
+		// unmount the target path if the volume can't be published, otherwise
+		// kubelet's retry finds it mounted and reports it as published
+		// without recording the pod status or syncing the secrets
+		defer func() {
+			if err != nil {
+				ns.volumes.remove(targetPath)
+				ns.cleanupTargetPath(targetPath)
+			}
+		}()
 
-		providerBinary := ns.getProviderPath(runtime.GOOS, providerName)
-		if _, err := os.Stat(providerBinary); err != nil {
-			log.Errorf("failed to find provider %s, err: %v for pod: %s, ns: %s", providerName, err, podUID, podNamespace)
-			return nil, err
-		}
+		log.Debugf("Calling provider: %s for pod: %s, ns: %s", providerName, podUID, podNamespace)
 
-		parametersStr, err := json.Marshal(parameters)
+		files, objectVersions, _, err := ns.mountSecretsStoreObjectContent(ctx, providerName, parameters, secrets, targetPath, nil)
 		if err != nil {
-			log.Errorf("failed to marshal parameters, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
+			ns.recordProviderError(events, providerName, err)
+			log.Errorf("error invoking provider, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
 			return nil, err
 		}
-		secretStr, err := json.Marshal(secrets)
-		if err != nil {
-			log.Errorf("failed to marshal secrets, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
-			return nil, err
+		// create/update secrets with mounted file content, the secret sync
+		// controller syncs them from the content secret of the volume in
+		// controller mode
+		if syncK8sSecret && ns.secretSyncMode != secretSyncModeController {
+			log.Debugf("[NodePublishVolume] syncK8sSecret is enabled for pod: %s, ns: %s", podUID, podNamespace)
+			contents, err := getFileContents(targetPath, files)
+			if err != nil {
+				log.Errorf("failed to get mounted file contents, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
+				return nil, err
+			}
+			ns.recordMissingObjects(events, contents, secretObjects)
+			err = syncK8sObjects(ctx, ns.client, contents, podNamespace, types.NamespacedName{Namespace: secretProviderClassNamespace, Name: secretProviderClass}, []metav1.OwnerReference{newPodOwnerReference(attrib[csipodname], podUID)}, secretObjects)
+			metrics.ReportK8sSecretSync(providerName, podNamespace, err)
+			if err != nil {
+				ns.recordForeignSecret(events, err)
+				log.Errorf("syncK8sObjects err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
+				return nil, err
+			}
 		}
-		permissionStr, err := json.Marshal(permission)
-		if err != nil {
-			log.Errorf("failed to marshal file permission, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
-			return nil, err
+
+		// track the volume so the mounted content can be rotated
+		vol := publishedVolume{
+			VolumeID:                     volumeID,
+			TargetPath:                   targetPath,
+			PodName:                      attrib[csipodname],
+			PodNamespace:                 attrib[csipodnamespace],
+			PodUID:                       attrib[csipoduid],
+			SecretProviderClass:          secretProviderClass,
+			SecretProviderClassNamespace: secretProviderClassNamespace,
+			ProviderName:                 providerName,
+			Secrets:                      secrets,
+			HasSecrets:                   len(secrets) > 0,
+			ServiceAccountName:           attrib[csipodsa],
+			ServiceAccountTokens:         attrib[csipodsatokens],
+			HasServiceAccountTokens:      len(attrib[csipodsatokens]) > 0,
+			SecretNames:                  ns.getSecretNames(secretObjects),
+			ObjectVersions:               objectVersions,
+			Files:                        getFilePaths(files),
+		}
+		if secretProviderClass == "" {
+			vol.Parameters = withoutServiceAccountTokens(parameters)
 		}
+		// the content secret is referenced by the
+		// secretproviderclasspodstatus object of the volume. Failing to
+		// write it doesn't fail the mount, it's written again when the
+		// volume is rotated.
+		if syncK8sSecret && ns.secretSyncMode == secretSyncModeController {
+			if err := ns.writeContentSecret(ctx, &vol, files, secretObjects); err != nil {
+				log.Errorf("failed to write content secret, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
+				ns.recordEvent(events, corev1.EventTypeWarning, contentSecretErrorReason, "failed to write content secret, err: %v", err)
+			}
+		}
+		ns.volumes.add(vol)
 
-		// mount before providers can write content to it
-		err = ns.mounter.Mount("tmpfs", targetPath, "tmpfs", []string{})
-		if err != nil {
-			log.Errorf("mount err: %v", err)
-			return nil, err
+		// record the mounted volume in a secretproviderclasspodstatus object
+		if secretProviderClass != "" {
+			if err := createOrUpdatePodStatus(ctx, ns.client, vol, ns.nodeID); err != nil {
+				log.Errorf("failed to create secretproviderclasspodstatus, err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
+				return nil, err
+			}
 		}
+	}
 
-		log.Debugf("Calling provider: %s for pod: %s, ns: %s", providerName, podUID, podNamespace)
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// mountSecretsStoreObjectContent invokes the provider to mount the secrets
+// store objects in the target path, which must already be mounted. The files
+// returned or written by the provider are validated and atomically swapped
+// into the target path. It returns the mounted files and object versions, and
+// true if the mounted files changed.
+func (ns *nodeServer) mountSecretsStoreObjectContent(ctx context.Context, providerName string, parameters, secrets map[string]string, targetPath string, oldObjectVersions map[string]string) ([]*v1alpha1.File, map[string]string, bool, error) {
+	// get provider volume path
+	providerVolumePath := ns.providerVolumePath
+	if providerVolumePath == "" {
+		return nil, nil, false, status.Error(codes.FailedPrecondition, "Providers volume path not found. Set PROVIDERS_VOLUME_PATH")
+	}
 
-		// check if minimum compatible provider version with current driver version is set
-		// if minimum version is not provided, skip check
-		if _, exists := ns.minProviderVersions[providerName]; !exists {
-			log.Warningf("minimum compatible %s provider version not set for pod: %s, ns: %s", providerName, podUID, podNamespace)
-		} else {
-			// check if provider is compatible with driver
-			providerCompatible, err := version.IsProviderCompatible(providerBinary, ns.minProviderVersions[providerName])
+	// providers serving the provider API on a socket are preferred over
+	// invoking the provider binary for every mount
+	usePlugin := ns.providerClients.HasProvider(providerName)
+	var providerBinary string
+	if !usePlugin {
+		providerBinary = ns.getProviderPath(runtime.GOOS, providerName)
+		if _, err := os.Stat(providerBinary); err != nil {
+			return nil, nil, false, status.Errorf(codes.NotFound, "failed to find provider %s, err: %v", providerName, err)
+		}
+		// the verified copy of the binary is used for the version check and
+		// the mount
+		if ns.providerVerifier != nil {
+			verifiedBinary, err := ns.providerVerifier.verify(providerName, providerBinary)
+			metrics.ReportProviderVerification(providerName, err)
 			if err != nil {
-				return nil, err
-			}
-			if !providerCompatible {
-				return nil, fmt.Errorf("Minimum supported %s provider version with current driver is %s", providerName, ns.minProviderVersions[providerName])
+				log.Errorf("refusing to execute provider %s, err: %v", providerName, err)
+				return nil, nil, false, err
 			}
+			providerBinary = verifiedBinary
+		}
+	}
+
+	parametersStr, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, nil, false, status.Errorf(codes.Internal, "failed to marshal parameters, err: %v", err)
+	}
+	secretStr, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, nil, false, status.Errorf(codes.Internal, "failed to marshal secrets, err: %v", err)
+	}
+	permissionStr, err := json.Marshal(permission)
+	if err != nil {
+		return nil, nil, false, status.Errorf(codes.Internal, "failed to marshal file permission, err: %v", err)
+	}
+
+	// providers that write the files themselves write them to a staging
+	// directory in the tmpfs so they can be swapped in atomically
+	stagingPath, err := ioutil.TempDir(targetPath, stagingDirPrefix)
+	if err != nil {
+		return nil, nil, false, status.Errorf(codes.Internal, "failed to create staging directory in target path %s: %v", targetPath, err)
+	}
+	defer os.RemoveAll(stagingPath)
+
+	// bound the provider call so a hung provider doesn't block the mount
+	// forever. The provider is killed when the timeout expires.
+	providerCtx, cancel := context.WithTimeout(ctx, ns.getProviderTimeout(providerName))
+	defer cancel()
+
+	var files []*v1alpha1.File
+	var objectVersions map[string]string
+	start := time.Now()
+	if usePlugin {
+		files, objectVersions, err = ns.callProviderPlugin(providerCtx, providerName, string(parametersStr), string(secretStr), stagingPath, string(permissionStr), oldObjectVersions)
+	} else {
+		files, objectVersions, err = ns.callProviderBinary(providerCtx, providerBinary, providerName, string(parametersStr), string(secretStr), stagingPath, string(permissionStr))
+	}
+	metrics.ReportProviderCall(providerName, getProviderCallStatus(providerCtx, err), time.Since(start))
+	if err != nil {
+		if providerCtx.Err() == context.DeadlineExceeded {
+			return nil, nil, false, status.Errorf(codes.DeadlineExceeded, "provider %s timed out after %v mounting secret", providerName, ns.getProviderTimeout(providerName))
+		}
+		// the provider output may contain the secrets of the volume
+		return nil, nil, false, redactSecrets(err, getSecretValues(secrets, parameters[csipodsatokens]))
+	}
+	if len(files) == 0 {
+		files, err = fileutil.ReadPayloads(stagingPath)
+		if err != nil {
+			return nil, nil, false, status.Errorf(codes.Internal, "failed to read files written by provider %s: %v", providerName, err)
+		}
+	}
+	if err := fileutil.Validate(files); err != nil {
+		return nil, nil, false, status.Errorf(codes.Internal, "invalid files returned by provider %s: %v", providerName, err)
+	}
+	changed, err := fileutil.WritePayloads(targetPath, files, permission)
+	if err != nil {
+		return nil, nil, false, status.Errorf(codes.Internal, "failed to write files to target path %s: %v", targetPath, err)
+	}
+	return files, objectVersions, changed, nil
+}
+
+// callProviderPlugin mounts the secrets store objects using the provider
+// plugin serving the provider API on a socket in the provider volume path.
+// It returns the files the driver needs to write to the target path.
+func (ns *nodeServer) callProviderPlugin(ctx context.Context, providerName, parameters, secrets, targetPath, permission string, oldObjectVersions map[string]string) ([]*v1alpha1.File, map[string]string, error) {
+	client, err := ns.providerClients.Get(ctx, providerName)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "failed to connect to provider %s, err: %v", providerName, err)
+	}
+	// check if minimum compatible provider version with current driver version is set
+	// if minimum version is not provided, skip check
+	_, checkVersion := ns.minProviderVersions[providerName]
+	if !checkVersion {
+		log.Warningf("minimum compatible %s provider version not set", providerName)
+	}
+	info, err := Version(ctx, client)
+	if err != nil {
+		if checkVersion {
+			return nil, nil, status.Errorf(providerErrorCode(err), "failed to get provider %s version, err: %v", providerName, err)
 		}
+		// the minimum driver version of providers that don't report their
+		// version can't be checked
+		log.Warningf("failed to get provider %s version, err: %v", providerName, err)
+	} else if err := ns.checkProviderCompatible(providerName, info); err != nil {
+		return nil, nil, err
+	}
 
-		args := []string{
-			"--attributes", string(parametersStr),
-			"--secrets", string(secretStr),
-			"--targetPath", string(targetPath),
-			"--permission", string(permissionStr),
+	log.Infof("provider plugin %s invoked for target path %s", providerName, targetPath)
+
+	objectVersions, files, errorCode, err := MountContent(ctx, client, parameters, secrets, targetPath, permission, oldObjectVersions)
+	if err != nil {
+		return nil, nil, status.Errorf(providerErrorCode(err), "provider %s failed to mount objects, error code: %q, err: %v", providerName, errorCode, err)
+	}
+	log.Debugf("provider %s mounted object versions %v", providerName, objectVersions)
+	return files, objectVersions, nil
+}
+
+// checkProviderCompatible checks that the provider version is compatible with
+// the driver, if the compatible provider versions are set, and that the driver
+// version is at least the minimum driver version the provider works with
+func (ns *nodeServer) checkProviderCompatible(providerName string, info *version.ProviderInfo) error {
+	// check if provider is compatible with driver
+	if minProviderVersion, exists := ns.minProviderVersions[providerName]; exists {
+		providerCompatible, err := version.IsProviderVersionCompatible(info.Version, minProviderVersion)
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "failed to check provider %s version, err: %v", providerName, err)
 		}
+		if !providerCompatible {
+			return &incompatibleProviderError{providerName: providerName, providerVersions: minProviderVersion}
+		}
+	}
+	// check if driver is compatible with provider
+	driverCompatible, err := version.IsDriverVersionCompatible(vendorVersion, info.MinDriverVersion)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to check minimum driver version of provider %s, err: %v", providerName, err)
+	}
+	if !driverCompatible {
+		return &incompatibleProviderError{providerName: providerName, minDriverVersion: info.MinDriverVersion}
+	}
+	return nil
+}
+
+// callProviderBinary mounts the secrets store objects by invoking the
+// provider binary with the mount arguments. Providers reporting the
+// stdinPayload capability read the mount request from stdin, other providers
+// get the arguments on the command line. It returns the files the driver
+// needs to write to the target path if the provider returned a mount response
+// on stdout.
+func (ns *nodeServer) callProviderBinary(ctx context.Context, providerBinary, providerName, parameters, secrets, targetPath, permission string) ([]*v1alpha1.File, map[string]string, error) {
+	// check if minimum compatible provider version with current driver version is set
+	// if minimum version is not provided, skip check
+	_, checkVersion := ns.minProviderVersions[providerName]
+	if !checkVersion {
+		log.Warningf("minimum compatible %s provider version not set", providerName)
+	}
+	info, err := ns.providerInfos.get(ctx, providerBinary)
+	if err != nil {
+		if checkVersion {
+			return nil, nil, status.Errorf(codes.Unavailable, "failed to get provider %s version, err: %v", providerName, err)
+		}
+		// providers that don't report their version get the arguments on the
+		// command line
+		log.Warningf("failed to get provider %s version and capabilities, err: %v", providerName, err)
+		info = &version.ProviderInfo{}
+	} else if err := ns.checkProviderCompatible(providerName, info); err != nil {
+		return nil, nil, err
+	}
 
+	var args []string
+	var stdin string
+	if info.HasCapability(stdinPayloadCapability) {
+		args = []string{stdinPayloadArg}
+		// the mount request is encoded like the mount response on stdout
+		m := jsonpb.Marshaler{}
+		stdin, err = m.MarshalToString(&v1alpha1.MountRequest{
+			Attributes: parameters,
+			Secrets:    secrets,
+			TargetPath: targetPath,
+			Permission: permission,
+		})
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "failed to marshal mount request, err: %v", err)
+		}
+		log.Infof("provider command invoked: %s %s, target path: %s", providerBinary, stdinPayloadArg, targetPath)
+	} else {
+		// the arguments of the process are visible to all processes on the
+		// node, only providers that don't support the stdin payload get the
+		// secrets on the command line. The service account tokens let anyone
+		// authenticate as the pod, so they're never passed on the command
+		// line.
+		var dropped bool
+		if parameters, dropped, err = removeServiceAccountTokens(parameters); err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "failed to remove service account tokens from parameters, err: %v", err)
+		}
+		if dropped {
+			log.Warningf("provider %s doesn't support the %s capability, not passing the service account tokens on the command line", providerName, stdinPayloadCapability)
+		}
+		args = []string{
+			"--attributes", parameters,
+			"--secrets", secrets,
+			"--targetPath", targetPath,
+			"--permission", permission,
+		}
 		log.Infof("provider command invoked: %s %s %v", providerBinary,
 			"--attributes [REDACTED] --secrets [REDACTED]", args[4:])
+	}
 
-		cmd := exec.Command(
-			providerBinary,
-			args...,
-		)
+	cmd := exec.Command(
+		providerBinary,
+		args...,
+	)
 
-		stdout := &bytes.Buffer{}
-		stderr := &bytes.Buffer{}
-		cmd.Stderr, cmd.Stdout = stderr, stdout
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr, cmd.Stdout = stderr, stdout
+	if len(stdin) > 0 {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
 
-		err = cmd.Run()
+	err = cmdutil.Run(ctx, cmd)
 
+	// the mount response contains the secret contents so it must not be logged
+	resp, ok := parseProviderOutput(stdout.Bytes())
+	if !ok {
 		log.Infof(string(stdout.String()))
-		if err != nil {
-			ns.mounter.Unmount(targetPath)
-			log.Errorf("error invoking provider, err: %v, output: %v for pod: %s, ns: %s", err, stderr.String(), podUID, podNamespace)
-			return nil, fmt.Errorf("error mounting secret %v for pod: %s, ns: %s", stderr.String(), podUID, podNamespace)
+	}
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "provider %s failed to mount objects, err: %v, output: %s", providerName, err, stderr.String())
+	}
+	if !ok {
+		return nil, nil, nil
+	}
+	objectVersions, files, errorCode, err := parseMountResponse(resp)
+	if err != nil {
+		return nil, nil, status.Errorf(providerErrorCode(err), "provider %s failed to mount objects, error code: %q, err: %v", providerName, errorCode, err)
+	}
+	log.Debugf("provider %s mounted object versions %v", providerName, objectVersions)
+	return files, objectVersions, nil
+}
+
+// getPublishedK8sObjects returns the secretproviderclasspodstatus object and
+// the names of the K8s secrets synced for the volume published at the target
+// path. Volumes that aren't tracked are looked up with the API server.
+func (ns *nodeServer) getPublishedK8sObjects(ctx context.Context, targetPath string) (*spcv1alpha1.SecretProviderClassPodStatus, []string, error) {
+	if vol, ok := ns.volumes.get(targetPath); ok {
+		if vol.SecretProviderClass == "" {
+			return nil, nil, nil
 		}
-		// create/update secrets with mounted file content
-		// add pod info to the secretProviderClass obj's byPod status field
-		if syncK8sSecret {
-			log.Debugf("[NodePublishVolume] syncK8sSecret is enabled for pod: %s, ns: %s", podUID, podNamespace)
-			err := syncK8sObjects(ctx, targetPath, podUID, podNamespace, secretProviderClass, secretObjects)
-			if err != nil {
-				log.Errorf("syncK8sObjects err: %v for pod: %s, ns: %s", err, podUID, podNamespace)
-				return nil, err
-			}
+		return newPodStatus(vol, ns.nodeID), vol.SecretNames, nil
+	}
+
+	podStatus, err := getPodStatusByTargetPath(ctx, ns.client, ns.nodeID, targetPath)
+	if err != nil || podStatus == nil {
+		return nil, nil, err
+	}
+	item, err := getSecretProviderClass(ctx, ns.reader, podStatus.Status.SecretProviderClassName, podStatus.Status.SecretProviderClassNamespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return podStatus, nil, nil
 		}
+		return nil, nil, err
+	}
+	// [optional field]
+	return podStatus, ns.getSecretNames(item.Spec.SecretObjects), nil
+}
 
+// getSecretNames returns the names of the K8s secrets the node deletes when
+// the volume is unpublished. The secret sync controller deletes the K8s
+// secrets in controller mode.
+func (ns *nodeServer) getSecretNames(secretObjects []spcv1alpha1.SecretObject) []string {
+	if ns.secretSyncMode == secretSyncModeController {
+		return nil
 	}
+	return getSecretNames(secretObjects)
+}
 
-	return &csi.NodePublishVolumeResponse{}, nil
+// getProviderCallStatus returns the exit status of a provider call reported
+// in the metrics
+func getProviderCallStatus(ctx context.Context, err error) string {
+	if err == nil {
+		return metrics.ProviderCallSuccess
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return metrics.ProviderCallTimeout
+	}
+	return metrics.ProviderCallError
 }
 
-func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
-	var secretObjects []interface{}
+// cleanupTargetPath removes the content written to the target path by a
+// failed mount and unmounts the tmpfs
+func (ns *nodeServer) cleanupTargetPath(targetPath string) {
+	if runtime.GOOS == "windows" {
+		if err := removeTargetPathContents(targetPath); err != nil {
+			log.Errorf("failed to remove content in target path %s, err: %v", targetPath, err)
+		}
+	}
+	if err := ns.mounter.Unmount(targetPath); err != nil {
+		log.Errorf("failed to unmount target path %s, err: %v", targetPath, err)
+	}
+}
+
+// removeVolume stops tracking the volume published at the target path and
+// stops the secretproviderclass caches of the namespaces no published volume
+// uses anymore
+func (ns *nodeServer) removeVolume(targetPath string) {
+	ns.volumes.remove(targetPath)
+	reader, ok := ns.reader.(*cachedReader)
+	if !ok {
+		return
+	}
+	inUse := make(map[string]bool)
+	for _, vol := range ns.volumes.list() {
+		inUse[vol.PodNamespace] = true
+		inUse[vol.SecretProviderClassNamespace] = true
+	}
+	reader.stopUnused(inUse)
+}
+
+// getProviderTimeout returns the timeout for a single provider call
+func (ns *nodeServer) getProviderTimeout(providerName string) time.Duration {
+	if timeout, exists := ns.providerTimeouts[providerName]; exists {
+		return timeout
+	}
+	return ns.providerTimeout
+}
+
+func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (_ *csi.NodeUnpublishVolumeResponse, err error) {
 	var podUID string
-	syncK8sSecret := false
+
+	// volumes published before the driver persisted its state aren't tracked
+	vol, tracked := ns.volumes.get(req.GetTargetPath())
+	start := time.Now()
+	defer func() {
+		metrics.ReportNodeUnpublish(vol.ProviderName, vol.PodNamespace, err, time.Since(start))
+	}()
 
 	// Check arguments
 	if len(req.GetVolumeId()) == 0 {
@@ -251,38 +671,34 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	}
 	targetPath := req.GetTargetPath()
 	volumeID := req.GetVolumeId()
-	files, err := getMountedFiles(targetPath)
+	if !ns.volumeLocks.tryAcquire(targetPath) {
+		return nil, status.Errorf(codes.Aborted, volumeOperationAlreadyExistsFmt, targetPath)
+	}
+	defer ns.volumeLocks.release(targetPath)
 
 	if isMockTargetPath(targetPath) {
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
 
-	podUID = getPodUIDFromTargetPath(runtime.GOOS, targetPath)
-	if len(podUID) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Cannot get podUID from Target path")
+	podUID = vol.PodUID
+	if !tracked {
+		podUID = getPodUIDFromTargetPath(runtime.GOOS, targetPath)
+		if len(podUID) == 0 {
+			return nil, status.Error(codes.InvalidArgument, "Cannot get podUID from Target path")
+		}
 	}
-	item, podNS, err := getItemWithPodID(ctx, podUID)
+	podStatus, secretNames, err := ns.getPublishedK8sObjects(ctx, targetPath)
 	if err != nil {
-		return nil, err
-	}
-	if item != nil {
-		// [optional field]
-		secretObjects, syncK8sSecret, err = getSecretObjectsFromSpec(item)
-		if err != nil {
-			log.Errorf("getSecretObjectsFromSpec err: %v for pod: %s. skipping sync", err, podUID)
-			syncK8sSecret = false
-		}
+		log.Errorf("failed to get secretproviderclasspodstatus, err: %v for pod: %s", err, podUID)
+		return nil, status.Error(codes.Internal, err.Error())
 	}
-
-	if syncK8sSecret {
-		log.Debugf("[NodeUnpublishVolume] syncK8sSecret is enabled for pod: %s", podUID)
-		// ensure podNS is valid as it is required for deleting secrets
-		if len(podNS) == 0 {
-			return nil, status.Error(codes.InvalidArgument, "Invalid podNS from secretproviderclasses obj")
+	if podStatus != nil {
+		if len(secretNames) > 0 {
+			log.Debugf("[NodeUnpublishVolume] syncK8sSecret is enabled for pod: %s", podUID)
 		}
-		// removeK8sObjects deletes secrets mapped to each mounted file
-		// it should also delete pod info from the secretProviderClass object's byPod status field
-		err := removeK8sObjects(ctx, targetPath, podUID, files, secretObjects)
+		// removeK8sObjects deletes the secretproviderclasspodstatus object and
+		// the secrets no longer used by any pod in the namespace
+		err = removeK8sObjects(ctx, ns.client, podStatus, secretNames)
 		if err != nil {
 			log.Errorf("removeK8sObjects err: %v for pod: %s", err, podUID)
 			return nil, status.Error(codes.Internal, err.Error())
@@ -290,12 +706,9 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	}
 	// remove files
 	if runtime.GOOS == "windows" {
-		for _, file := range files {
-			err = os.RemoveAll(file)
-			if err != nil {
-				log.Errorf("failed to remove file %s, err: %v for pod: %s", file, err, podUID)
-				return nil, status.Error(codes.Internal, err.Error())
-			}
+		if err := removeTargetPathContents(targetPath); err != nil {
+			log.Errorf("failed to remove content in target path %s, err: %v for pod: %s", targetPath, err, podUID)
+			return nil, status.Error(codes.Internal, err.Error())
 		}
 	}
 	err = mount.CleanupMountPoint(targetPath, ns.mounter, false)
@@ -303,6 +716,7 @@ func (ns *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 		log.Errorf("error cleaning and unmounting target path %s, err: %v for pod: %s", targetPath, err, podUID)
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	ns.removeVolume(targetPath)
 
 	log.Debugf("targetPath %s volumeID %s has been unmounted for pod: %s", targetPath, volumeID, podUID)
 	return &csi.NodeUnpublishVolumeResponse{}, nil
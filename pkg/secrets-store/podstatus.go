@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+// getPodStatusName returns the name of the secretproviderclasspodstatus
+// object of a pod volume. The name is a hash of the pod UID and the volume ID
+// so it's unique for every volume of every pod and a valid object name
+// regardless of the length of the pod and secretproviderclass names, which
+// are set as labels instead.
+func getPodStatusName(podUID, volumeID string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(podUID+"/"+volumeID)))
+}
+
+// getPodStatusLabels returns the labels of the secretproviderclasspodstatus
+// object of a pod volume. Names that aren't valid label values are only
+// set in the status of the object.
+func getPodStatusLabels(vol publishedVolume, nodeID string) map[string]string {
+	labels := map[string]string{
+		spcv1alpha1.InternalNodeLabel: nodeID,
+		spcv1alpha1.PodUIDLabel:       vol.PodUID,
+	}
+	if len(validation.IsValidLabelValue(vol.PodName)) == 0 {
+		labels[spcv1alpha1.PodNameLabel] = vol.PodName
+	}
+	if len(validation.IsValidLabelValue(vol.SecretProviderClass)) == 0 {
+		labels[spcv1alpha1.SecretProviderClassLabel] = vol.SecretProviderClass
+	}
+	return labels
+}
+
+// newPodOwnerReference returns the owner reference of the objects owned by the
+// pod consuming a volume
+func newPodOwnerReference(podName, podUID string) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       podName,
+		UID:        types.UID(podUID),
+	}
+}
+
+// newPodStatus returns the secretproviderclasspodstatus object of the
+// published volume. The object is owned by the pod so it's garbage collected
+// when the pod is deleted.
+func newPodStatus(vol publishedVolume, nodeID string) *spcv1alpha1.SecretProviderClassPodStatus {
+	var objects []spcv1alpha1.SecretProviderClassObject
+	for id, version := range vol.ObjectVersions {
+		objects = append(objects, spcv1alpha1.SecretProviderClassObject{ID: id, Version: version})
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].ID < objects[j].ID
+	})
+
+	return &spcv1alpha1.SecretProviderClassPodStatus{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getPodStatusName(vol.PodUID, vol.VolumeID),
+			Namespace: vol.PodNamespace,
+			Labels:    getPodStatusLabels(vol, nodeID),
+			OwnerReferences: []metav1.OwnerReference{
+				newPodOwnerReference(vol.PodName, vol.PodUID),
+			},
+		},
+		Status: spcv1alpha1.SecretProviderClassPodStatusStatus{
+			PodName:                      vol.PodName,
+			SecretProviderClassName:      vol.SecretProviderClass,
+			SecretProviderClassNamespace: vol.SecretProviderClassNamespace,
+			Mounted:                      true,
+			TargetPath:                   vol.TargetPath,
+			NodeName:                     nodeID,
+			Objects:                      objects,
+			Files:                        vol.Files,
+			ContentSecretName:            vol.ContentSecretName,
+			ContentSecretVersion:         vol.ContentSecretVersion,
+			ContentSecretUpdateTime:      vol.ContentSecretUpdateTime,
+		},
+	}
+}
+
+// createOrUpdatePodStatus creates or updates the secretproviderclasspodstatus
+// object of the published volume
+func createOrUpdatePodStatus(ctx context.Context, c client.Client, vol publishedVolume, nodeID string) error {
+	podStatus := newPodStatus(vol, nodeID)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := &spcv1alpha1.SecretProviderClassPodStatus{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: podStatus.Namespace, Name: podStatus.Name}, current)
+		if errors.IsNotFound(err) {
+			log.Infof("creating secretproviderclasspodstatus %s for pod: %s, ns: %s", podStatus.Name, vol.PodUID, vol.PodNamespace)
+			return c.Create(ctx, podStatus.DeepCopy())
+		}
+		if err != nil {
+			return err
+		}
+		if current.Labels == nil {
+			current.Labels = make(map[string]string)
+		}
+		for k, v := range podStatus.Labels {
+			current.Labels[k] = v
+		}
+		current.OwnerReferences = podStatus.OwnerReferences
+		current.Status = podStatus.Status
+		return c.Update(ctx, current)
+	})
+}
+
+// getPodStatusByTargetPath returns the secretproviderclasspodstatus object of
+// the volume mounted at the target path on the node, or nil if it doesn't
+// exist
+func getPodStatusByTargetPath(ctx context.Context, c client.Client, nodeID, targetPath string) (*spcv1alpha1.SecretProviderClassPodStatus, error) {
+	podStatuses := &spcv1alpha1.SecretProviderClassPodStatusList{}
+	if err := c.List(ctx, podStatuses, client.MatchingLabels{spcv1alpha1.InternalNodeLabel: nodeID}); err != nil {
+		return nil, err
+	}
+	for i := range podStatuses.Items {
+		if podStatuses.Items[i].Status.TargetPath == targetPath {
+			return &podStatuses.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// deletePodStatus deletes the secretproviderclasspodstatus object
+func deletePodStatus(ctx context.Context, c client.Client, podStatus *spcv1alpha1.SecretProviderClassPodStatus) error {
+	if err := c.Delete(ctx, podStatus); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.Infof("deleted secretproviderclasspodstatus %s, ns: %s", podStatus.Name, podStatus.Namespace)
+	return nil
+}
+
+// getPodStatusCount returns the number of secretproviderclasspodstatus
+// objects in the namespace referencing the secretproviderclass object
+func getPodStatusCount(ctx context.Context, c client.Client, namespace string, secretProviderClass types.NamespacedName) (int, error) {
+	podStatuses := &spcv1alpha1.SecretProviderClassPodStatusList{}
+	if err := c.List(ctx, podStatuses, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, podStatus := range podStatuses.Items {
+		if podStatus.Status.SecretProviderClassName == secretProviderClass.Name &&
+			podStatus.Status.SecretProviderClassNamespace == secretProviderClass.Namespace {
+			count++
+		}
+	}
+	return count, nil
+}
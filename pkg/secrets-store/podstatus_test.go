@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func init() {
+	// the fake client decodes listed objects with the client-go scheme
+	_ = spcv1alpha1.AddToScheme(clientgoscheme.Scheme)
+}
+
+func TestCreateOrUpdatePodStatus(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewFakeClientWithScheme(scheme)
+	vol := publishedVolume{
+		VolumeID:                     "csi-vol1",
+		TargetPath:                   "/var/lib/kubelet/pods/uid1/volumes/kubernetes.io~csi/secrets-store-inline/mount",
+		PodName:                      "pod1",
+		PodNamespace:                 "default",
+		PodUID:                       "uid1",
+		SecretProviderClass:          "spc1",
+		SecretProviderClassNamespace: "default",
+		ObjectVersions:               map[string]string{"secret2": "v1", "secret1": "v1"},
+	}
+
+	err := createOrUpdatePodStatus(ctx, c, vol, "node1")
+	assert.NoError(t, err)
+
+	podStatus := &spcv1alpha1.SecretProviderClassPodStatus{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "csi-vol1")}, podStatus)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		spcv1alpha1.InternalNodeLabel:        "node1",
+		spcv1alpha1.PodUIDLabel:              "uid1",
+		spcv1alpha1.PodNameLabel:             "pod1",
+		spcv1alpha1.SecretProviderClassLabel: "spc1",
+	}, podStatus.Labels)
+	assert.Equal(t, 1, len(podStatus.OwnerReferences))
+	assert.Equal(t, types.UID("uid1"), podStatus.OwnerReferences[0].UID)
+	assert.True(t, podStatus.Status.Mounted)
+	assert.Equal(t, vol.TargetPath, podStatus.Status.TargetPath)
+	assert.Equal(t, []spcv1alpha1.SecretProviderClassObject{{ID: "secret1", Version: "v1"}, {ID: "secret2", Version: "v1"}}, podStatus.Status.Objects)
+
+	// rotated object versions update the existing object
+	vol.ObjectVersions = map[string]string{"secret1": "v2", "secret2": "v1"}
+	err = createOrUpdatePodStatus(ctx, c, vol, "node1")
+	assert.NoError(t, err)
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "csi-vol1")}, podStatus)
+	assert.NoError(t, err)
+	assert.Equal(t, []spcv1alpha1.SecretProviderClassObject{{ID: "secret1", Version: "v2"}, {ID: "secret2", Version: "v1"}}, podStatus.Status.Objects)
+}
+
+func TestGetPodStatusName(t *testing.T) {
+	// pods a-b in namespace c and a in namespace b-c don't collide
+	assert.NotEqual(t, getPodStatusName("uid1", "csi-vol1"), getPodStatusName("uid2", "csi-vol1"))
+	// volumes of a pod using the same secretproviderclass don't collide
+	assert.NotEqual(t, getPodStatusName("uid1", "csi-vol1"), getPodStatusName("uid1", "csi-vol2"))
+	assert.Len(t, getPodStatusName("uid1", strings.Repeat("v", 300)), 64)
+
+	// names that aren't valid label values are only set in the status
+	vol := publishedVolume{VolumeID: "csi-vol1", PodName: strings.Repeat("p", 100), PodNamespace: "default", PodUID: "uid1", SecretProviderClass: "spc1"}
+	podStatus := newPodStatus(vol, "node1")
+	_, ok := podStatus.Labels[spcv1alpha1.PodNameLabel]
+	assert.False(t, ok)
+	assert.Equal(t, vol.PodName, podStatus.Status.PodName)
+	assert.Equal(t, "spc1", podStatus.Labels[spcv1alpha1.SecretProviderClassLabel])
+}
+
+func TestGetPodStatusByTargetPath(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewFakeClientWithScheme(scheme,
+		newPodStatus(publishedVolume{TargetPath: "/target1", PodName: "pod1", PodNamespace: "ns1", PodUID: "uid1", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns1"}, "node1"),
+		newPodStatus(publishedVolume{TargetPath: "/target2", PodName: "pod2", PodNamespace: "ns1", PodUID: "uid2", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns1"}, "node2"),
+	)
+
+	podStatus, err := getPodStatusByTargetPath(ctx, c, "node1", "/target1")
+	assert.NoError(t, err)
+	assert.NotNil(t, podStatus)
+	assert.Equal(t, getPodStatusName("uid1", ""), podStatus.Name)
+
+	// the object of another node is ignored
+	podStatus, err = getPodStatusByTargetPath(ctx, c, "node1", "/target2")
+	assert.NoError(t, err)
+	assert.Nil(t, podStatus)
+}
+
+func TestGetPodStatusCount(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewFakeClientWithScheme(scheme,
+		newPodStatus(publishedVolume{TargetPath: "/target1", PodName: "pod1", PodNamespace: "ns1", PodUID: "uid1", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns1"}, "node1"),
+		newPodStatus(publishedVolume{TargetPath: "/target2", PodName: "pod2", PodNamespace: "ns1", PodUID: "uid2", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns1"}, "node2"),
+		newPodStatus(publishedVolume{TargetPath: "/target3", PodName: "pod3", PodNamespace: "ns1", PodUID: "uid3", SecretProviderClass: "spc1", SecretProviderClassNamespace: "shared"}, "node1"),
+		newPodStatus(publishedVolume{TargetPath: "/target4", PodName: "pod4", PodNamespace: "ns2", PodUID: "uid4", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns2"}, "node1"),
+	)
+
+	count, err := getPodStatusCount(ctx, c, "ns1", types.NamespacedName{Namespace: "ns1", Name: "spc1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	podStatus, err := getPodStatusByTargetPath(ctx, c, "node1", "/target1")
+	assert.NoError(t, err)
+	err = deletePodStatus(ctx, c, podStatus)
+	assert.NoError(t, err)
+
+	count, err = getPodStatusCount(ctx, c, "ns1", types.NamespacedName{Namespace: "ns1", Name: "spc1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
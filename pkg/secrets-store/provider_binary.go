@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+)
+
+const (
+	// stdinPayloadCapability is reported by provider binaries that read the
+	// JSON encoded MountRequest from stdin when invoked with stdinPayloadArg,
+	// so the attributes and the secrets aren't visible in the process
+	// arguments
+	stdinPayloadCapability = "stdinPayload"
+	stdinPayloadArg        = "--stdin-payload"
+)
+
+// providerInfoCache caches the version and the capabilities reported by the
+// provider binaries so they aren't invoked with --version before every
+// mount. An entry is invalidated when the binary changes.
+type providerInfoCache struct {
+	lock  sync.Mutex
+	infos map[string]cachedProviderInfo
+}
+
+type cachedProviderInfo struct {
+	modTime time.Time
+	size    int64
+	info    *version.ProviderInfo
+}
+
+func newProviderInfoCache() *providerInfoCache {
+	return &providerInfoCache{
+		infos: make(map[string]cachedProviderInfo),
+	}
+}
+
+// get returns the version and the capabilities of the provider binary
+func (c *providerInfoCache) get(ctx context.Context, providerBinary string) (*version.ProviderInfo, error) {
+	fi, err := os.Stat(providerBinary)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	cached, ok := c.infos[providerBinary]
+	c.lock.Unlock()
+	if ok && cached.modTime.Equal(fi.ModTime()) && cached.size == fi.Size() {
+		return cached.info, nil
+	}
+
+	// the lock isn't held while the provider runs so a hung provider doesn't
+	// block the other providers
+	info, err := version.GetProviderInfo(ctx, providerBinary)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	c.infos[providerBinary] = cachedProviderInfo{modTime: fi.ModTime(), size: fi.Size(), info: info}
+	c.lock.Unlock()
+	return info, nil
+}
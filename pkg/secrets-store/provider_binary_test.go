@@ -0,0 +1,211 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// stdinProvider records the mount request read from stdin and its
+	// arguments next to the provider binary
+	stdinProvider = `#!/bin/sh
+if [ "$1" = "--version" ]; then
+  echo '{"version":"0.0.10","capabilities":["stdinPayload"]}'
+  exit 0
+fi
+echo "$@" > "$(dirname "$0")/args"
+cat > "$(dirname "$0")/request"
+echo '{"files":[{"path":"object1","contents":"c2VjcmV0"}]}'
+`
+	// legacyProvider doesn't report its version and only records its
+	// arguments
+	legacyProvider = `#!/bin/sh
+if [ "$1" = "--version" ]; then
+  exit 1
+fi
+echo "$@" > "$(dirname "$0")/args"
+echo '{"files":[{"path":"object1","contents":"c2VjcmV0"}]}'
+`
+)
+
+func TestCallProviderBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test on windows")
+	}
+
+	tokens := `{"vault":{"token":"token1","expirationTimestamp":"2020-07-01T10:00:00Z"}}`
+	withTokens, err := json.Marshal(map[string]string{"param1": "value1", csipodsatokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		desc            string
+		provider        string
+		parameters      string
+		expectedArgs    string
+		expectedRequest *v1alpha1.MountRequest
+	}{
+		{
+			desc:         "provider reading the mount request from stdin",
+			provider:     stdinProvider,
+			parameters:   string(withTokens),
+			expectedArgs: "--stdin-payload\n",
+			expectedRequest: &v1alpha1.MountRequest{
+				Attributes: string(withTokens),
+				Secrets:    `{"clientsecret":"s3cr3t"}`,
+				TargetPath: "/target",
+				Permission: "420",
+			},
+		},
+		{
+			desc:         "legacy provider",
+			provider:     legacyProvider,
+			parameters:   `{"param1":"value1"}`,
+			expectedArgs: `--attributes {"param1":"value1"} --secrets {"clientsecret":"s3cr3t"} --targetPath /target --permission 420` + "\n",
+		},
+		{
+			desc:         "legacy provider doesn't get the service account tokens",
+			provider:     legacyProvider,
+			parameters:   string(withTokens),
+			expectedArgs: `--attributes {"param1":"value1"} --secrets {"clientsecret":"s3cr3t"} --targetPath /target --permission 420` + "\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "provider")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			providerBinary := filepath.Join(dir, "provider-provider1")
+			if err := ioutil.WriteFile(providerBinary, []byte(tc.provider), 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: dir}, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, _, err := ns.callProviderBinary(context.Background(), providerBinary, "provider1", tc.parameters, `{"clientsecret":"s3cr3t"}`, "/target", "420")
+			assert.NoError(t, err)
+			assert.Equal(t, []*v1alpha1.File{{Path: "object1", Contents: []byte("secret")}}, files)
+
+			args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedArgs, string(args))
+			if tc.expectedRequest != nil {
+				request, err := ioutil.ReadFile(filepath.Join(dir, "request"))
+				assert.NoError(t, err)
+				actualRequest := &v1alpha1.MountRequest{}
+				assert.NoError(t, jsonpb.UnmarshalString(string(request), actualRequest))
+				assert.Equal(t, tc.expectedRequest, actualRequest)
+			}
+		})
+	}
+}
+
+func TestCallProviderBinaryIncompatible(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test on windows")
+	}
+
+	cases := []struct {
+		desc                string
+		version             string
+		minProviderVersions string
+		expectedErr         string
+	}{
+		{
+			desc:                "provider version not in range",
+			version:             `{"version":"0.1.2"}`,
+			minProviderVersions: "provider1=>=0.0.5 <0.1.0",
+			expectedErr:         "Supported provider1 provider versions with current driver are >=0.0.5 <0.1.0",
+		},
+		{
+			desc:        "driver version older than provider min driver version",
+			version:     `{"version":"0.1.2","minDriverVersion":"v1.0.0"}`,
+			expectedErr: "Minimum supported driver version with provider1 provider is v1.0.0, current driver version is " + vendorVersion,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "provider")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			providerBinary := filepath.Join(dir, "provider-provider1")
+			provider := "#!/bin/sh\necho '" + tc.version + "'\n"
+			if err := ioutil.WriteFile(providerBinary, []byte(provider), 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: dir, MinProviderVersions: tc.minProviderVersions}, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = ns.callProviderBinary(context.Background(), providerBinary, "provider1", "{}", "{}", "/target", "420")
+			assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestProviderInfoCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test on windows")
+	}
+	dir, err := ioutil.TempDir("", "provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	providerBinary := filepath.Join(dir, "provider-provider1")
+	if err := ioutil.WriteFile(providerBinary, []byte(stdinProvider), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newProviderInfoCache()
+	info, err := c.get(context.Background(), providerBinary)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.10", info.Version)
+	assert.True(t, info.HasCapability(stdinPayloadCapability))
+
+	// the cached info is invalidated when the binary is upgraded
+	if err := ioutil.WriteFile(providerBinary, []byte(legacyProvider), 0700); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.get(context.Background(), providerBinary)
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	version "sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// providerAPIVersion is the version of the provider API used by the driver
+	providerAPIVersion = "v1alpha1"
+	// providerSocketSuffix is the suffix of the unix domain socket a provider
+	// plugin listens on in the provider volume path
+	providerSocketSuffix = ".sock"
+)
+
+// providerNameRegex restricts provider names so they can't be used to
+// reference sockets or binaries outside of the provider volume path
+var providerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// PluginClientBuilder builds and caches gRPC clients for provider plugins
+// serving the provider API on unix domain sockets.
+type PluginClientBuilder struct {
+	socketPath string
+	conns      map[string]*grpc.ClientConn
+	clients    map[string]v1alpha1.CSIDriverProviderClient
+	lock       sync.RWMutex
+	opts       []grpc.DialOption
+}
+
+// NewPluginClientBuilder creates a PluginClientBuilder that will connect to
+// plugins in the provided absolute path to a folder. Plugin servers must listen
+// on the unix domain socket at:
+//
+//	<path>/<plugin_name>.sock
+//
+// where plugin_name is the name of the provider.
+func NewPluginClientBuilder(path string, opts ...grpc.DialOption) *PluginClientBuilder {
+	return &PluginClientBuilder{
+		socketPath: path,
+		conns:      make(map[string]*grpc.ClientConn),
+		clients:    make(map[string]v1alpha1.CSIDriverProviderClient),
+		opts: append([]grpc.DialOption{
+			grpc.WithInsecure(), // the interface is only secured through filesystem ACLs
+			grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", target)
+			}),
+		}, opts...),
+	}
+}
+
+// socketFile returns the path to the unix domain socket of the provider
+func (p *PluginClientBuilder) socketFile(provider string) string {
+	return filepath.Join(p.socketPath, provider+providerSocketSuffix)
+}
+
+// HasProvider returns true if the provider serves the provider API on a
+// socket in the provider volume path. Providers without a socket are invoked
+// as binaries.
+func (p *PluginClientBuilder) HasProvider(provider string) bool {
+	if !providerNameRegex.MatchString(provider) {
+		return false
+	}
+	fi, err := os.Stat(p.socketFile(provider))
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeSocket != 0
+}
+
+// Get returns a CSIDriverProviderClient for the provider. Connections are
+// cached and reused across calls.
+func (p *PluginClientBuilder) Get(ctx context.Context, provider string) (v1alpha1.CSIDriverProviderClient, error) {
+	if !providerNameRegex.MatchString(provider) {
+		return nil, fmt.Errorf("%s is not a valid provider name", provider)
+	}
+
+	p.lock.RLock()
+	client, ok := p.clients[provider]
+	p.lock.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	// dial and check the health of the provider without holding the lock so
+	// an unresponsive provider doesn't block the clients of other providers
+	conn, err := grpc.DialContext(ctx, p.socketFile(provider), p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	client = v1alpha1.NewCSIDriverProviderClient(conn)
+
+	resp, err := client.Health(ctx, &v1alpha1.HealthRequest{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !resp.GetHealthy() {
+		conn.Close()
+		return nil, fmt.Errorf("provider %s is not healthy: %s", provider, resp.GetMessage())
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// keep the client of another caller that connected to the provider
+	// concurrently
+	if existing, ok := p.clients[provider]; ok {
+		conn.Close()
+		return existing, nil
+	}
+	log.Infof("connected to provider plugin %s at %s", provider, p.socketFile(provider))
+	p.conns[provider] = conn
+	p.clients[provider] = client
+	return client, nil
+}
+
+// Cleanup closes all underlying connections and removes all clients.
+func (p *PluginClientBuilder) Cleanup() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for provider, conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			log.Errorf("failed to close connection to provider %s, err: %v", provider, err)
+		}
+	}
+	p.conns = make(map[string]*grpc.ClientConn)
+	p.clients = make(map[string]v1alpha1.CSIDriverProviderClient)
+}
+
+// Version returns the version of the provider binary served by the plugin and
+// the minimum driver version it works with
+func Version(ctx context.Context, client v1alpha1.CSIDriverProviderClient) (*version.ProviderInfo, error) {
+	resp, err := client.Version(ctx, &v1alpha1.VersionRequest{Version: providerAPIVersion})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetVersion() != providerAPIVersion {
+		return nil, fmt.Errorf("provider api version %s is not supported, expected %s", resp.GetVersion(), providerAPIVersion)
+	}
+	log.Debugf("provider: %s, version: %s, min driver version: %s", resp.GetRuntimeName(), resp.GetRuntimeVersion(), resp.GetMinDriverVersion())
+	return &version.ProviderInfo{Version: resp.GetRuntimeVersion(), MinDriverVersion: resp.GetMinDriverVersion()}, nil
+}
+
+// MountContent calls the client's Mount() RPC with helpers to format the
+// request and interpret the response. It returns the mounted object versions,
+// the files the driver needs to write to the target path and the provider
+// error code if the provider failed to mount the objects.
+func MountContent(ctx context.Context, client v1alpha1.CSIDriverProviderClient, attributes, secrets, targetPath, permission string, oldObjectVersions map[string]string) (map[string]string, []*v1alpha1.File, string, error) {
+	var objVersions []*v1alpha1.ObjectVersion
+	for obj, version := range oldObjectVersions {
+		objVersions = append(objVersions, &v1alpha1.ObjectVersion{Id: obj, Version: version})
+	}
+
+	req := &v1alpha1.MountRequest{
+		Attributes:           attributes,
+		Secrets:              secrets,
+		TargetPath:           targetPath,
+		Permission:           permission,
+		CurrentObjectVersion: objVersions,
+	}
+
+	resp, err := client.Mount(ctx, req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return parseMountResponse(resp)
+}
+
+// parseMountResponse returns the object versions and files of a mount
+// response, or an error with the provider error code if the mount failed.
+func parseMountResponse(resp *v1alpha1.MountResponse) (map[string]string, []*v1alpha1.File, string, error) {
+	if resp != nil && resp.GetError() != nil && len(resp.GetError().GetCode()) > 0 {
+		return nil, nil, resp.GetError().GetCode(), fmt.Errorf("mount request failed with provider error code %s", resp.GetError().GetCode())
+	}
+
+	objectVersions := make(map[string]string)
+	for _, v := range resp.GetObjectVersion() {
+		objectVersions[v.GetId()] = v.GetVersion()
+	}
+	return objectVersions, resp.GetFiles(), "", nil
+}
+
+// parseProviderOutput parses the stdout of a provider binary. Providers
+// return the files to write as a JSON encoded MountResponse. The second return
+// value is false when the output isn't a MountResponse, which is the case for
+// providers that write the files to the target path themselves.
+func parseProviderOutput(stdout []byte) (*v1alpha1.MountResponse, bool) {
+	if len(bytes.TrimSpace(stdout)) == 0 || bytes.TrimSpace(stdout)[0] != '{' {
+		return nil, false
+	}
+	resp := &v1alpha1.MountResponse{}
+	u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := u.Unmarshal(bytes.NewReader(stdout), resp); err != nil {
+		return nil, false
+	}
+	if len(resp.GetFiles()) == 0 && resp.GetError() == nil {
+		return nil, false
+	}
+	return resp, true
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	version "sigs.k8s.io/secrets-store-csi-driver/pkg/version"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+type fakeProviderServer struct {
+	errorCode string
+	// objectVersion and contents of object1, defaults to v1 and secret
+	objectVersion string
+	contents      string
+	// noObjectVersions omits the object versions from the mount response
+	noObjectVersions bool
+	// minDriverVersion is the minimum driver version reported by Version
+	minDriverVersion string
+	// mounting, if set, is signaled when a mount request is received and the
+	// request is blocked until unblock is closed
+	mounting chan struct{}
+	unblock  chan struct{}
+
+	lock sync.Mutex
+	// attributes of the last mount request
+	attributes string
+}
+
+func (f *fakeProviderServer) lastAttributes() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.attributes
+}
+
+func (f *fakeProviderServer) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
+	return &v1alpha1.VersionResponse{Version: "v1alpha1", RuntimeName: "fakeprovider", RuntimeVersion: "0.0.5", MinDriverVersion: f.minDriverVersion}, nil
+}
+
+func (f *fakeProviderServer) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+	if f.mounting != nil {
+		f.mounting <- struct{}{}
+		<-f.unblock
+	}
+	f.lock.Lock()
+	f.attributes = req.GetAttributes()
+	f.lock.Unlock()
+	if len(f.errorCode) > 0 {
+		return &v1alpha1.MountResponse{Error: &v1alpha1.Error{Code: f.errorCode}}, nil
+	}
+	objectVersion, contents := "v1", "secret"
+	if len(f.objectVersion) > 0 {
+		objectVersion, contents = f.objectVersion, f.contents
+	}
+	resp := &v1alpha1.MountResponse{
+		ObjectVersion: []*v1alpha1.ObjectVersion{{Id: "secret/object1", Version: objectVersion}},
+		Files:         []*v1alpha1.File{{Path: "object1", Contents: []byte(contents)}},
+	}
+	if f.noObjectVersions {
+		resp.ObjectVersion = nil
+	}
+	return resp, nil
+}
+
+func (f *fakeProviderServer) Health(ctx context.Context, req *v1alpha1.HealthRequest) (*v1alpha1.HealthResponse, error) {
+	return &v1alpha1.HealthResponse{Healthy: true}, nil
+}
+
+func newFakeProviderServer(t *testing.T, socketPath string, f *fakeProviderServer) *grpc.Server {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socketPath, err)
+	}
+	server := grpc.NewServer()
+	v1alpha1.RegisterCSIDriverProviderServer(server, f)
+	go server.Serve(listener)
+	return server
+}
+
+func TestPluginClientBuilder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newFakeProviderServer(t, filepath.Join(dir, "fakeprovider.sock"), &fakeProviderServer{})
+	defer server.Stop()
+
+	cb := NewPluginClientBuilder(dir)
+	defer cb.Cleanup()
+
+	assert.True(t, cb.HasProvider("fakeprovider"))
+	assert.False(t, cb.HasProvider("otherprovider"))
+	assert.False(t, cb.HasProvider("../fakeprovider"))
+
+	ctx := context.Background()
+	client, err := cb.Get(ctx, "fakeprovider")
+	assert.NoError(t, err)
+
+	info, err := Version(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, &version.ProviderInfo{Version: "0.0.5"}, info)
+
+	objectVersions, files, errorCode, err := MountContent(ctx, client, "{}", "{}", "/tmp/target", "420", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, errorCode)
+	assert.Equal(t, map[string]string{"secret/object1": "v1"}, objectVersions)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "object1", files[0].GetPath())
+	assert.Equal(t, []byte("secret"), files[0].GetContents())
+
+	_, err = cb.Get(ctx, "../fakeprovider")
+	assert.Error(t, err)
+}
+
+func TestPluginClientBuilderUnresponsiveProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newFakeProviderServer(t, filepath.Join(dir, "fakeprovider.sock"), &fakeProviderServer{})
+	defer server.Stop()
+	// the unresponsive provider accepts connections but never answers
+	listener, err := net.Listen("unix", filepath.Join(dir, "unresponsive.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	cb := NewPluginClientBuilder(dir)
+	defer cb.Cleanup()
+
+	unresponsiveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		_, err := cb.Get(unresponsiveCtx, "unresponsive")
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancelGet := context.WithTimeout(context.Background(), time.Second)
+	defer cancelGet()
+	_, err = cb.Get(ctx, "fakeprovider")
+	assert.NoError(t, err)
+
+	cancel()
+	assert.Error(t, <-done)
+}
+
+func TestMountContentProviderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := newFakeProviderServer(t, filepath.Join(dir, "fakeprovider.sock"), &fakeProviderServer{errorCode: "AuthenticationFailed"})
+	defer server.Stop()
+
+	cb := NewPluginClientBuilder(dir)
+	defer cb.Cleanup()
+
+	ctx := context.Background()
+	client, err := cb.Get(ctx, "fakeprovider")
+	assert.NoError(t, err)
+
+	_, _, errorCode, err := MountContent(ctx, client, "{}", "{}", "/tmp/target", "420", nil)
+	assert.Error(t, err)
+	assert.Equal(t, "AuthenticationFailed", errorCode)
+}
+
+func TestParseProviderOutput(t *testing.T) {
+	cases := []struct {
+		desc          string
+		stdout        string
+		expectedFiles []*v1alpha1.File
+		expectedOk    bool
+	}{
+		{
+			desc:       "empty output",
+			stdout:     "",
+			expectedOk: false,
+		},
+		{
+			desc:       "log output from provider writing files",
+			stdout:     "INFO: wrote object1\n",
+			expectedOk: false,
+		},
+		{
+			desc:       "json log output from provider writing files",
+			stdout:     `{"level":"info","msg":"wrote object1"}`,
+			expectedOk: false,
+		},
+		{
+			desc:          "mount response",
+			stdout:        `{"objectVersion":[{"id":"object1","version":"v1"}],"files":[{"path":"object1","mode":420,"contents":"c2VjcmV0"}]}`,
+			expectedFiles: []*v1alpha1.File{{Path: "object1", Mode: 420, Contents: []byte("secret")}},
+			expectedOk:    true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			resp, ok := parseProviderOutput([]byte(tc.stdout))
+			assert.Equal(t, tc.expectedOk, ok)
+			if ok {
+				assert.Equal(t, len(tc.expectedFiles), len(resp.GetFiles()))
+				for i := range tc.expectedFiles {
+					assert.Equal(t, tc.expectedFiles[i].GetPath(), resp.GetFiles()[i].GetPath())
+					assert.Equal(t, tc.expectedFiles[i].GetMode(), resp.GetFiles()[i].GetMode())
+					assert.Equal(t, tc.expectedFiles[i].GetContents(), resp.GetFiles()[i].GetContents())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// signatureSuffix is the suffix of the detached signature file next to
+	// the provider binary
+	signatureSuffix = ".sig"
+	sha256Prefix    = "sha256:"
+)
+
+// providerVerifier verifies the provider binaries before they're executed.
+// The SHA-256 digest of the binary must be in the allow-list of the provider
+// or, for providers without an allow-list, the detached signature of the
+// binary must be valid for the configured public key.
+//
+// The provider volume is a hostPath that can be written by other node agents,
+// so the driver executes a private copy of the verified binary instead of the
+// binary in the provider volume, which could be replaced after it's verified.
+type providerVerifier struct {
+	// digests are the allowed hex encoded SHA-256 digests by provider
+	digests   map[string][]string
+	publicKey crypto.PublicKey
+	// dir contains the verified copies of the provider binaries
+	dir string
+
+	lock sync.Mutex
+	// copies are the paths of the verified copies by digest
+	copies map[string]string
+}
+
+// providerVerificationError is returned when a provider binary fails the
+// verification
+type providerVerificationError struct {
+	providerName string
+	reason       string
+}
+
+func (e *providerVerificationError) Error() string {
+	return fmt.Sprintf("provider %s failed verification: %s", e.providerName, e.reason)
+}
+
+// GRPCStatus returns the error as a PermissionDenied gRPC status
+func (e *providerVerificationError) GRPCStatus() *status.Status {
+	return status.New(codes.PermissionDenied, e.Error())
+}
+
+// newProviderVerifier returns a verifier for the provider digests, e.g.
+// provider1=sha256:<hex>,provider2=sha256:<hex>, and the PEM encoded public
+// key in publicKeyFile. Providers can be listed multiple times to allow
+// several digests. It returns nil if neither is set.
+func newProviderVerifier(providerDigests, publicKeyFile string) (*providerVerifier, error) {
+	if len(providerDigests) == 0 && len(publicKeyFile) == 0 {
+		return nil, nil
+	}
+	digests, err := parseProviderDigests(providerDigests)
+	if err != nil {
+		return nil, err
+	}
+	var publicKey crypto.PublicKey
+	if len(publicKeyFile) > 0 {
+		if publicKey, err = loadPublicKey(publicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := ioutil.TempDir("", "secrets-store-providers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for verified provider binaries, err: %v", err)
+	}
+	return &providerVerifier{
+		digests:   digests,
+		publicKey: publicKey,
+		dir:       dir,
+		copies:    make(map[string]string),
+	}, nil
+}
+
+func parseProviderDigests(providerDigests string) (map[string][]string, error) {
+	digests := make(map[string][]string)
+	if len(providerDigests) == 0 {
+		return digests, nil
+	}
+	for _, pd := range strings.Split(providerDigests, ",") {
+		parts := strings.Split(strings.TrimSpace(pd), "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("provider digest not defined in expected format provider=sha256:digest, got %s", pd)
+		}
+		provider := strings.TrimSpace(parts[0])
+		digest := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(parts[1]), sha256Prefix))
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("%s provider digest %s is not a valid sha256 digest", provider, parts[1])
+		}
+		digests[provider] = append(digests[provider], digest)
+	}
+	return digests, nil
+}
+
+func loadPublicKey(publicKeyFile string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(publicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider public key, err: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found in %s", publicKeyFile)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provider public key, err: %v", err)
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported provider public key type %T. Only rsa and ecdsa are supported", publicKey)
+	}
+}
+
+// verify verifies the provider binary and returns the path of its verified
+// copy to execute
+func (v *providerVerifier) verify(providerName, providerBinary string) (string, error) {
+	data, err := ioutil.ReadFile(providerBinary)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to read provider %s, err: %v", providerName, err)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if err := v.check(providerName, providerBinary, sum[:], digest); err != nil {
+		return "", &providerVerificationError{providerName: providerName, reason: err.Error()}
+	}
+	log.Debugf("provider %s verified, sha256 digest: %s", providerName, digest)
+	return v.copy(providerBinary, digest, data)
+}
+
+func (v *providerVerifier) check(providerName, providerBinary string, sum []byte, digest string) error {
+	if allowed, ok := v.digests[providerName]; ok {
+		for _, d := range allowed {
+			if d == digest {
+				return nil
+			}
+		}
+		return fmt.Errorf("sha256 digest %s of %s is not allowed", digest, providerBinary)
+	}
+	if v.publicKey == nil {
+		return fmt.Errorf("no sha256 digests allowed and no public key configured")
+	}
+	signature, err := readSignature(providerBinary + signatureSuffix)
+	if err != nil {
+		return err
+	}
+	return verifySignature(v.publicKey, sum, signature)
+}
+
+// readSignature reads the base64 or raw encoded detached signature
+func readSignature(signatureFile string) ([]byte, error) {
+	data, err := ioutil.ReadFile(signatureFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature, err: %v", err)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		return decoded, nil
+	}
+	return data, nil
+}
+
+// verifySignature verifies the signature of the SHA-256 digest, a PKCS #1
+// v1.5 signature for rsa keys or an ASN.1 encoded signature for ecdsa keys
+func verifySignature(publicKey crypto.PublicKey, sum, signature []byte) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum, signature); err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(signature, &sig); err != nil || len(rest) > 0 {
+			return fmt.Errorf("invalid signature encoding")
+		}
+		if !ecdsa.Verify(key, sum, sig.R, sig.S) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// copy returns the path of the private copy of the verified binary, which is
+// written the first time the digest is verified
+func (v *providerVerifier) copy(providerBinary, digest string, data []byte) (string, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if path, ok := v.copies[digest]; ok {
+		return path, nil
+	}
+
+	dir := filepath.Join(v.dir, digest)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", status.Errorf(codes.Internal, "failed to copy verified provider binary, err: %v", err)
+	}
+	path := filepath.Join(dir, filepath.Base(providerBinary))
+	if err := ioutil.WriteFile(path, data, 0700); err != nil {
+		return "", status.Errorf(codes.Internal, "failed to copy verified provider binary, err: %v", err)
+	}
+	v.copies[digest] = path
+	return path, nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseProviderDigests(t *testing.T) {
+	digest1, digest2 := strings.Repeat("a", 64), strings.Repeat("b", 64)
+
+	digests, err := parseProviderDigests("provider1=sha256:" + digest1 + ", provider1=" + strings.ToUpper(digest2) + ",provider2=sha256:" + digest2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"provider1": {digest1, digest2},
+		"provider2": {digest2},
+	}, digests)
+
+	_, err = parseProviderDigests("provider1")
+	assert.Error(t, err)
+	_, err = parseProviderDigests("provider1=sha256:abc")
+	assert.Error(t, err)
+}
+
+func TestProviderVerifierDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	providerBinary := filepath.Join(dir, "provider-provider1")
+	if err := ioutil.WriteFile(providerBinary, []byte("provider1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("provider1"))
+
+	v, err := newProviderVerifier("provider1=sha256:"+hex.EncodeToString(sum[:]), "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(v.dir)
+
+	// the verified copy is executed instead of the binary
+	verifiedBinary, err := v.verify("provider1", providerBinary)
+	assert.NoError(t, err)
+	assert.NotEqual(t, providerBinary, verifiedBinary)
+	assert.Equal(t, "provider-provider1", filepath.Base(verifiedBinary))
+	data, err := ioutil.ReadFile(verifiedBinary)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("provider1"), data)
+
+	// the binary was replaced
+	if err := ioutil.WriteFile(providerBinary, []byte("malicious"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.verify("provider1", providerBinary)
+	assert.IsType(t, &providerVerificationError{}, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// providers without allowed digests are refused without a public key
+	_, err = v.verify("provider2", providerBinary)
+	assert.IsType(t, &providerVerificationError{}, err)
+
+	// no verification is configured
+	v, err = newProviderVerifier("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestProviderVerifierSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	providerBinary := filepath.Join(dir, "provider-provider1")
+	if err := ioutil.WriteFile(providerBinary, []byte("provider1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("provider1"))
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, ecdsaKey, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaSignature, err := asn1.Marshal(struct{ R, S interface{} }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		desc        string
+		publicKey   crypto.PublicKey
+		signature   []byte
+		expectedErr bool
+	}{
+		{
+			desc:      "base64 encoded ecdsa signature",
+			publicKey: &ecdsaKey.PublicKey,
+			signature: []byte(base64.StdEncoding.EncodeToString(ecdsaSignature) + "\n"),
+		},
+		{
+			desc:      "raw rsa signature",
+			publicKey: &rsaKey.PublicKey,
+			signature: rsaSignature,
+		},
+		{
+			desc:        "signature made with another key",
+			publicKey:   &rsaKey.PublicKey,
+			signature:   ecdsaSignature,
+			expectedErr: true,
+		},
+		{
+			desc:        "missing signature",
+			publicKey:   &ecdsaKey.PublicKey,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			os.Remove(providerBinary + signatureSuffix)
+			if tc.signature != nil {
+				if err := ioutil.WriteFile(providerBinary+signatureSuffix, tc.signature, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			der, err := x509.MarshalPKIXPublicKey(tc.publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			publicKeyFile := filepath.Join(dir, "provider.pub")
+			if err := ioutil.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := newProviderVerifier("", publicKeyFile)
+			assert.NoError(t, err)
+			defer os.RemoveAll(v.dir)
+			_, err = v.verify("provider1", providerBinary)
+			if tc.expectedErr {
+				assert.IsType(t, &providerVerificationError{}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/metrics"
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+// runRotation rotates the content of the published volumes every
+// pollInterval until stopCh is closed
+func (ns *nodeServer) runRotation(pollInterval time.Duration, stopCh <-chan struct{}) {
+	log.Infof("starting secret rotation with poll interval %v", pollInterval)
+	wait.Until(func() {
+		ns.rotateSecrets(context.Background())
+	}, pollInterval, stopCh)
+}
+
+// rotateSecrets re-invokes the provider for every published volume to update
+// the mounted content and the synced K8s secrets
+func (ns *nodeServer) rotateSecrets(ctx context.Context) {
+	for _, vol := range ns.volumes.list() {
+		// the volume is rotated in the next poll if it's being published or
+		// unpublished
+		if !ns.volumeLocks.tryAcquire(vol.TargetPath) {
+			log.Debugf("operation in progress for target path %s, skip rotating secrets for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+			continue
+		}
+		result, err := ns.rotateVolume(ctx, vol)
+		ns.volumeLocks.release(vol.TargetPath)
+		if err != nil {
+			log.Errorf("failed to rotate secrets in target path %s, err: %v for pod: %s, ns: %s", vol.TargetPath, err, vol.PodUID, vol.PodNamespace)
+		}
+		// volumes that are no longer mounted are skipped
+		if result != "" {
+			ns.volumes.setRotationError(vol.TargetPath, err)
+			metrics.ReportRotation(vol.ProviderName, vol.PodNamespace, result)
+		}
+	}
+}
+
+// rotateVolume updates the content mounted in the volume's target path. It
+// returns the result of the rotation reported in the metrics, or an empty
+// result if the volume was skipped.
+func (ns *nodeServer) rotateVolume(ctx context.Context, vol publishedVolume) (string, error) {
+	notMnt, err := ns.mounter.IsLikelyNotMountPoint(vol.TargetPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the volume was unpublished without the driver being called
+			log.Infof("target path %s no longer exists, stop rotating secrets for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+			ns.removeVolume(vol.TargetPath)
+			return "", nil
+		}
+		return metrics.RotationError, err
+	}
+	// IsLikelyNotMountPoint always returns notMnt=true for windows
+	if notMnt && runtime.GOOS != "windows" {
+		log.Debugf("target path %s is not mounted, skip rotating secrets for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+		return "", nil
+	}
+
+	// the nodePublishSecretRef isn't persisted, so volumes recovered after a
+	// restart can't be rotated until they're published again
+	if vol.HasSecrets && vol.Secrets == nil {
+		log.Debugf("nodePublishSecretRef of target path %s is unknown, skip rotating secrets for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+		return "", nil
+	}
+	// the service account tokens are known again once kubelet republishes
+	// the volume
+	if vol.HasServiceAccountTokens && len(vol.ServiceAccountTokens) == 0 {
+		log.Debugf("service account tokens of target path %s are unknown, skip rotating secrets for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+		return "", nil
+	}
+
+	providerName := vol.ProviderName
+	parameters := withoutServiceAccountTokens(vol.Parameters)
+	var secretObjects []spcv1alpha1.SecretObject
+	syncK8sSecret := false
+	if vol.SecretProviderClass != "" {
+		// read the secretProviderClass again to pick up changes to the parameters
+		item, err := getSecretProviderClass(ctx, ns.reader, vol.SecretProviderClass, vol.SecretProviderClassNamespace)
+		if err != nil {
+			return metrics.RotationError, err
+		}
+		if err := validateSecretProviderClass(item); err != nil {
+			return metrics.RotationError, err
+		}
+		providerName = string(item.Spec.Provider)
+		parameters = getParameters(item)
+		// [optional field]
+		secretObjects = item.Spec.SecretObjects
+		syncK8sSecret = len(secretObjects) > 0
+		parameters[csipodname] = vol.PodName
+		parameters[csipodnamespace] = vol.PodNamespace
+		parameters[csipoduid] = vol.PodUID
+		if len(vol.ServiceAccountName) > 0 {
+			parameters[csipodsa] = vol.ServiceAccountName
+		}
+	}
+	if vol.HasServiceAccountTokens {
+		parameters[csipodsatokens] = vol.ServiceAccountTokens
+	}
+
+	events := eventObjects(vol.PodName, vol.PodNamespace, vol.PodUID, vol.SecretProviderClass, vol.SecretProviderClassNamespace)
+	log.Debugf("rotating secrets in target path %s with provider %s for pod: %s, ns: %s", vol.TargetPath, providerName, vol.PodUID, vol.PodNamespace)
+
+	files, objectVersions, changed, err := ns.mountSecretsStoreObjectContent(ctx, providerName, parameters, vol.Secrets, vol.TargetPath, vol.ObjectVersions)
+	if err != nil {
+		return metrics.RotationError, err
+	}
+	ns.volumes.setFiles(vol.TargetPath, getFilePaths(files))
+	vol.Files = getFilePaths(files)
+	// the content secret is written again if it failed when the volume was
+	// published
+	writeContentSecret := syncK8sSecret && ns.secretSyncMode == secretSyncModeController
+	contentSecretPending := writeContentSecret && len(vol.ContentSecretName) == 0
+	// the synced K8s secrets and the secretproviderclasspodstatus object are
+	// up to date if neither the mounted files nor the object versions changed
+	// since the last successful rotation
+	if !changed && objectVersionsEqual(objectVersions, vol.ObjectVersions) && len(vol.RotationError) == 0 && !contentSecretPending {
+		log.Debugf("secrets in target path %s are unchanged for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+		return metrics.RotationUnchanged, nil
+	}
+	vol.ObjectVersions = objectVersions
+
+	// the new content secret version in the secretproviderclasspodstatus
+	// object triggers the secret sync controller
+	if writeContentSecret {
+		if err := ns.writeContentSecret(ctx, &vol, files, secretObjects); err != nil {
+			ns.recordEvent(events, corev1.EventTypeWarning, contentSecretErrorReason, "failed to write content secret, err: %v", err)
+			return metrics.RotationError, err
+		}
+		ns.volumes.setContentSecret(vol.TargetPath, vol.ContentSecretName, vol.ContentSecretVersion, vol.ContentSecretUpdateTime)
+	}
+	if vol.SecretProviderClass != "" {
+		if err := createOrUpdatePodStatus(ctx, ns.client, vol, ns.nodeID); err != nil {
+			return metrics.RotationError, err
+		}
+	}
+
+	if syncK8sSecret && ns.secretSyncMode != secretSyncModeController {
+		ns.volumes.setSecretNames(vol.TargetPath, ns.getSecretNames(secretObjects))
+		contents, err := getFileContents(vol.TargetPath, files)
+		if err != nil {
+			return metrics.RotationError, err
+		}
+		ns.recordMissingObjects(events, contents, secretObjects)
+		err = syncK8sObjects(ctx, ns.client, contents, vol.PodNamespace, types.NamespacedName{Namespace: vol.SecretProviderClassNamespace, Name: vol.SecretProviderClass}, []metav1.OwnerReference{newPodOwnerReference(vol.PodName, vol.PodUID)}, secretObjects)
+		metrics.ReportK8sSecretSync(providerName, vol.PodNamespace, err)
+		if err != nil {
+			ns.recordForeignSecret(events, err)
+			return metrics.RotationError, err
+		}
+	}
+	// the object versions are only updated once the K8s secrets are synced,
+	// so a failed sync is retried on the next rotation
+	ns.volumes.setObjectVersions(vol.TargetPath, objectVersions)
+	log.Infof("rotated secrets in target path %s for pod: %s, ns: %s", vol.TargetPath, vol.PodUID, vol.PodNamespace)
+	ns.recordEvent(events, corev1.EventTypeNormal, secretRotatedReason, "rotated secrets store objects with provider %s, object versions: %v", providerName, objectVersions)
+	return metrics.RotationRotated, nil
+}
+
+// objectVersionsEqual returns true if the object versions are the same.
+// Providers that don't report object versions have none.
+func objectVersionsEqual(objectVersions, other map[string]string) bool {
+	if len(objectVersions) == 0 && len(other) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(objectVersions, other)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/mount"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/metrics"
+)
+
+func TestRotateSecrets(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	server := newFakeProviderServer(t, filepath.Join(providerDir, "fakeprovider.sock"), &fakeProviderServer{objectVersion: "v2", contents: "rotated"})
+	defer server.Stop()
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	ns.mounter = mount.NewFakeMounter([]mount.MountPoint{{Path: targetPath}})
+	recorder := record.NewFakeRecorder(10)
+	ns.recorder = recorder
+
+	ns.volumes.add(publishedVolume{
+		TargetPath:     targetPath,
+		PodName:        "pod1",
+		PodNamespace:   "default",
+		PodUID:         "pod1",
+		ProviderName:   "fakeprovider",
+		Parameters:     map[string]string{},
+		ObjectVersions: map[string]string{"secret/object1": "v1"},
+	})
+	ns.volumes.add(publishedVolume{
+		TargetPath:   filepath.Join(targetPath, "unpublished"),
+		PodUID:       "pod2",
+		ProviderName: "fakeprovider",
+	})
+
+	ns.rotateSecrets(context.Background())
+
+	data, err := ioutil.ReadFile(filepath.Join(targetPath, "object1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated"), data)
+
+	vol, ok := ns.volumes.get(targetPath)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"secret/object1": "v2"}, vol.ObjectVersions)
+	assert.Equal(t, "Normal SecretRotated rotated secrets store objects with provider fakeprovider, object versions: map[secret/object1:v2]", <-recorder.Events)
+
+	// volumes with a target path that no longer exists are no longer tracked
+	_, ok = ns.volumes.get(filepath.Join(targetPath, "unpublished"))
+	assert.False(t, ok)
+
+	// the rotation isn't recorded if nothing changed
+	result, err := ns.rotateVolume(context.Background(), vol)
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.RotationUnchanged, result)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestRotateSecretsWithoutObjectVersions(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	provider := &fakeProviderServer{objectVersion: "v1", contents: "secret", noObjectVersions: true}
+	server := newFakeProviderServer(t, filepath.Join(providerDir, "fakeprovider.sock"), provider)
+	defer server.Stop()
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	ns.mounter = mount.NewFakeMounter([]mount.MountPoint{{Path: targetPath}})
+	recorder := record.NewFakeRecorder(10)
+	ns.recorder = recorder
+
+	vol := publishedVolume{
+		TargetPath:   targetPath,
+		PodName:      "pod1",
+		PodNamespace: "default",
+		PodUID:       "pod1",
+		ProviderName: "fakeprovider",
+		Parameters:   map[string]string{},
+	}
+	ns.volumes.add(vol)
+
+	// the first rotation writes the files
+	result, err := ns.rotateVolume(context.Background(), vol)
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.RotationRotated, result)
+	assert.Len(t, recorder.Events, 1)
+	<-recorder.Events
+
+	// the same content isn't rotated again
+	vol, _ = ns.volumes.get(targetPath)
+	result, err = ns.rotateVolume(context.Background(), vol)
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.RotationUnchanged, result)
+	assert.Empty(t, recorder.Events)
+
+	// changed content is rotated
+	provider.contents = "rotated"
+	vol, _ = ns.volumes.get(targetPath)
+	result, err = ns.rotateVolume(context.Background(), vol)
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.RotationRotated, result)
+	assert.Len(t, recorder.Events, 1)
+	data, err := ioutil.ReadFile(filepath.Join(targetPath, "object1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated"), data)
+}
@@ -17,8 +17,14 @@ limitations under the License.
 package secretsstore
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	csicommon "sigs.k8s.io/secrets-store-csi-driver/pkg/csi-common"
 	version "sigs.k8s.io/secrets-store-csi-driver/pkg/version"
@@ -39,25 +45,112 @@ var (
 	vendorVersion = "0.0.9"
 )
 
+// defaultProviderTimeout bounds the provider calls if Options doesn't set a
+// provider timeout
+const defaultProviderTimeout = time.Minute
+
+// Options configures the secrets store driver
+type Options struct {
+	DriverName string
+	NodeID     string
+	Endpoint   string
+	// ProviderVolumePath is the path of the provider binaries and sockets
+	ProviderVolumePath string
+	// MinProviderVersions are the minimum versions or version ranges of the
+	// supported providers, e.g. provider1=0.0.2,provider2=>=0.0.5 <0.1.0
+	MinProviderVersions string
+	// ProviderTimeout bounds a single provider call, defaults to 1 minute
+	ProviderTimeout time.Duration
+	// ProviderTimeouts override ProviderTimeout per provider, e.g.
+	// provider1=30s,provider2=2m
+	ProviderTimeouts string
+	// ProviderDigests are the allowed sha256 digests of the provider binaries
+	ProviderDigests string
+	// ProviderPublicKey verifies the signatures of the provider binaries
+	// without allowed digests
+	ProviderPublicKey                  string
+	EnableSecretRotation               bool
+	RotationPollInterval               time.Duration
+	SharedSecretProviderClassNamespace string
+	// StateDir persists the state of the published volumes, the state is
+	// only kept in memory if empty
+	StateDir              string
+	EnableOrphanCleanup   bool
+	OrphanCleanupInterval time.Duration
+	OrphanCleanupDryRun   bool
+	// SecretSyncMode is inline or controller, defaults to inline. In
+	// controller mode, the K8s secrets are synced by RunSecretSync.
+	SecretSyncMode string
+	// SecretSyncLeaderElection elects a single secret sync controller among
+	// the replicas running RunSecretSync
+	SecretSyncLeaderElection bool
+}
+
 // GetDriver returns a new secrets store driver
 func GetDriver() *SecretsStore {
 	return &SecretsStore{}
 }
 
-func newNodeServer(d *csicommon.CSIDriver, providerVolumePath, minProviderVersions string) (*nodeServer, error) {
+func newNodeServer(d *csicommon.CSIDriver, opts Options, c client.Client, reader client.Reader, recorder record.EventRecorder) (*nodeServer, error) {
 	// get a map of provider and compatible version
-	minProviderVersionsMap, err := version.GetMinimumProviderVersions(minProviderVersions)
+	minProviderVersionsMap, err := version.GetMinimumProviderVersions(opts.MinProviderVersions)
 	if err != nil {
 		return nil, err
 	}
 	if len(minProviderVersionsMap) == 0 {
 		log.Infof("minimum compatible provider versions not specified with --min-provider-version")
 	}
+	providerTimeout := opts.ProviderTimeout
+	if providerTimeout == 0 {
+		providerTimeout = defaultProviderTimeout
+	}
+	if providerTimeout < 0 {
+		return nil, fmt.Errorf("provider timeout must be greater than 0, got %v", providerTimeout)
+	}
+	// get a map of provider and timeout overriding the default provider timeout
+	providerTimeoutsMap, err := getProviderTimeouts(opts.ProviderTimeouts)
+	if err != nil {
+		return nil, err
+	}
+	secretSyncMode := opts.SecretSyncMode
+	switch secretSyncMode {
+	case "":
+		secretSyncMode = secretSyncModeInline
+	case secretSyncModeInline, secretSyncModeController:
+	default:
+		return nil, fmt.Errorf("secret sync mode must be %s or %s, got %s", secretSyncModeInline, secretSyncModeController, secretSyncMode)
+	}
+	// verify the provider binaries before they're executed if digests or a
+	// public key are set
+	providerVerifier, err := newProviderVerifier(opts.ProviderDigests, opts.ProviderPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	// recover the volumes published before the driver restarted
+	volumes := newPublishedVolumes()
+	if len(opts.StateDir) > 0 {
+		if volumes, err = loadPublishedVolumes(opts.StateDir); err != nil {
+			return nil, err
+		}
+	}
 	return &nodeServer{
-		DefaultNodeServer:   csicommon.NewDefaultNodeServer(d),
-		providerVolumePath:  providerVolumePath,
-		minProviderVersions: minProviderVersionsMap,
-		mounter:             mount.New(""),
+		DefaultNodeServer:                  csicommon.NewDefaultNodeServer(d),
+		providerVolumePath:                 opts.ProviderVolumePath,
+		minProviderVersions:                minProviderVersionsMap,
+		providerTimeout:                    providerTimeout,
+		providerTimeouts:                   providerTimeoutsMap,
+		providerVerifier:                   providerVerifier,
+		providerInfos:                      newProviderInfoCache(),
+		mounter:                            mount.New(""),
+		providerClients:                    NewPluginClientBuilder(opts.ProviderVolumePath),
+		nodeID:                             opts.NodeID,
+		client:                             c,
+		reader:                             reader,
+		volumes:                            volumes,
+		volumeLocks:                        newVolumeLocks(),
+		eventRecorder:                      eventRecorder{recorder: recorder},
+		sharedSecretProviderClassNamespace: opts.SharedSecretProviderClassNamespace,
+		secretSyncMode:                     secretSyncMode,
 	}, nil
 }
 
@@ -75,14 +168,21 @@ func newIdentityServer(d *csicommon.CSIDriver) *identityServer {
 }
 
 // Run starts the CSI plugin
-func (s *SecretsStore) Run(driverName, nodeID, endpoint, providerVolumePath, minProviderVersions string) {
-	log.Infof("Driver: %v ", driverName)
+func (s *SecretsStore) Run(opts Options) {
+	log.Infof("Driver: %v ", opts.DriverName)
 	log.Infof("Version: %s", vendorVersion)
-	log.Infof("Provider Volume Path: %s", providerVolumePath)
-	log.Infof("Minimum provider versions: %s", minProviderVersions)
+	log.Infof("Provider Volume Path: %s", opts.ProviderVolumePath)
+	log.Infof("Minimum provider versions: %s", opts.MinProviderVersions)
+	log.Infof("Provider timeout: %v, provider timeouts: %s", opts.ProviderTimeout, opts.ProviderTimeouts)
+	log.Infof("Provider digests: %s, provider public key: %s", opts.ProviderDigests, opts.ProviderPublicKey)
+	log.Infof("Secret rotation enabled: %t, rotation poll interval: %v", opts.EnableSecretRotation, opts.RotationPollInterval)
+	log.Infof("Shared secretproviderclass namespace: %s", opts.SharedSecretProviderClassNamespace)
+	log.Infof("State dir: %s", opts.StateDir)
+	log.Infof("Orphaned volume cleanup enabled: %t, interval: %v, dry run: %t", opts.EnableOrphanCleanup, opts.OrphanCleanupInterval, opts.OrphanCleanupDryRun)
+	log.Infof("Secret sync mode: %s", opts.SecretSyncMode)
 
 	// Initialize default library driver
-	s.driver = csicommon.NewCSIDriver(driverName, vendorVersion, nodeID)
+	s.driver = csicommon.NewCSIDriver(opts.DriverName, vendorVersion, opts.NodeID)
 	if s.driver == nil {
 		log.Fatal("Failed to initialize SecretsStore CSI Driver.")
 	}
@@ -95,7 +195,19 @@ func (s *SecretsStore) Run(driverName, nodeID, endpoint, providerVolumePath, min
 		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
 	})
 
-	ns, err := newNodeServer(s.driver, providerVolumePath, minProviderVersions)
+	c, reader, err := newKubeClients(wait.NeverStop)
+	if err != nil {
+		// volumes that don't reference a secretproviderclass can still be
+		// published without the API server
+		log.Warningf("failed to initialize kubernetes clients, requests to the API server will fail, error: %+v", err)
+		unavailable := &unavailableClient{err: err}
+		c, reader = unavailable, unavailable
+	}
+	recorder, err := newEventRecorder(opts.DriverName, opts.NodeID)
+	if err != nil {
+		log.Warningf("failed to initialize event recorder, events will not be recorded, error: %+v", err)
+	}
+	ns, err := newNodeServer(s.driver, opts, c, reader, recorder)
 	if err != nil {
 		log.Fatalf("failed to initialize node server, error: %+v", err)
 	}
@@ -103,7 +215,20 @@ func (s *SecretsStore) Run(driverName, nodeID, endpoint, providerVolumePath, min
 	s.cs = newControllerServer(s.driver)
 	s.ids = newIdentityServer(s.driver)
 
+	if opts.EnableSecretRotation {
+		if opts.RotationPollInterval <= 0 {
+			log.Fatalf("rotation poll interval must be greater than 0, got %v", opts.RotationPollInterval)
+		}
+		go s.ns.runRotation(opts.RotationPollInterval, wait.NeverStop)
+	}
+	if opts.EnableOrphanCleanup {
+		if opts.OrphanCleanupInterval <= 0 {
+			log.Fatalf("orphan cleanup interval must be greater than 0, got %v", opts.OrphanCleanupInterval)
+		}
+		go s.ns.runOrphanCleanup(opts.OrphanCleanupInterval, opts.OrphanCleanupDryRun, wait.NeverStop)
+	}
+
 	server := csicommon.NewNonBlockingGRPCServer()
-	server.Start(endpoint, s.ids, s.cs, s.ns)
+	server.Start(opts.Endpoint, s.ids, s.cs, s.ns)
 	server.Wait()
 }
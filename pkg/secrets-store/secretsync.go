@@ -0,0 +1,470 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/metrics"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+const (
+	// secretSyncModeInline syncs the K8s secrets when volumes are published
+	// and rotated
+	secretSyncModeInline = "inline"
+	// secretSyncModeController writes the mounted content of the synced
+	// objects to content secrets when volumes are published and rotated, the
+	// secret sync controller syncs the K8s secrets from them
+	secretSyncModeController = "controller"
+	// secretSyncControllerName is the name of the secret sync controller, of
+	// its leader election lock and the source of its events
+	secretSyncControllerName = "secrets-store-csi-driver-secret-sync"
+	// contentSecretKey is the key of the content secret data holding the
+	// JSON encoded contents of the synced objects keyed by object name
+	contentSecretKey = "contents.json"
+)
+
+// secretSyncReconciler creates, updates and deletes the K8s secrets synced
+// from the secretproviderclass objects used in a namespace. It runs as a
+// single cluster-wide controller and never reads the mounted volumes: the
+// nodes write the mounted content of the synced objects to a content secret
+// per volume and reference it in the secretproviderclasspodstatus object of
+// the volume. The secrets of a secretproviderclass are synced from the content
+// secret written last, the first by name of the secretproviderclasspodstatus
+// object if several were written at the same time.
+//
+// The reconcile requests are keyed by the name of the pod namespace.
+type secretSyncReconciler struct {
+	// client reads the K8s secrets from and writes them to the API server
+	client client.Client
+	// reader reads the secretproviderclasspodstatus and secretproviderclass
+	// objects from the manager cache
+	reader client.Reader
+	eventRecorder
+}
+
+var _ reconcile.Reconciler = &secretSyncReconciler{}
+
+// RunSecretSync runs the secret sync controller syncing the K8s secrets of
+// the volumes published by drivers in controller mode. The controller can run
+// anywhere in the cluster, a single replica is elected with leader election.
+func RunSecretSync(opts Options) {
+	log.Infof("starting secret sync controller, leader election: %t", opts.SecretSyncLeaderElection)
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Fatalf("failed to get kubeconfig for secret sync, error: %+v", err)
+	}
+	mgr, err := manager.New(cfg, manager.Options{
+		Scheme: scheme,
+		// the process serves its own metrics
+		MetricsBindAddress: "0",
+		LeaderElection:     opts.SecretSyncLeaderElection,
+		LeaderElectionID:   secretSyncControllerName,
+	})
+	if err != nil {
+		log.Fatalf("failed to create secret sync manager, error: %+v", err)
+	}
+	// the K8s secrets are read from the API server, the manager client would
+	// cache every secret in the cluster
+	c, err := client.New(cfg, client.Options{Scheme: scheme, Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		log.Fatalf("failed to create secret sync client, error: %+v", err)
+	}
+	r := &secretSyncReconciler{
+		client:        c,
+		reader:        mgr.GetCache(),
+		eventRecorder: eventRecorder{recorder: mgr.GetEventRecorderFor(secretSyncControllerName)},
+	}
+	if err := r.setupWithManager(mgr); err != nil {
+		log.Fatalf("failed to set up secret sync controller, error: %+v", err)
+	}
+	if err := mgr.Start(wait.NeverStop); err != nil {
+		log.Fatalf("secret sync manager stopped, error: %+v", err)
+	}
+}
+
+// setupWithManager reconciles a namespace when the
+// secretproviderclasspodstatus objects of the namespace or the
+// secretproviderclass objects used in the namespace change
+func (r *secretSyncReconciler) setupWithManager(mgr manager.Manager) error {
+	c, err := controller.New("secret-sync", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(&source.Kind{Type: &spcv1alpha1.SecretProviderClassPodStatus{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(podStatusRequests),
+	}); err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &spcv1alpha1.SecretProviderClass{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.secretProviderClassRequests),
+	})
+}
+
+// podStatusRequests returns the request of the namespace of the
+// secretproviderclasspodstatus object
+func podStatusRequests(o handler.MapObject) []reconcile.Request {
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: o.Meta.GetNamespace()}},
+	}
+}
+
+// secretProviderClassRequests returns the requests of the namespaces the
+// secretproviderclass object is used in
+func (r *secretSyncReconciler) secretProviderClassRequests(o handler.MapObject) []reconcile.Request {
+	podStatuses := &spcv1alpha1.SecretProviderClassPodStatusList{}
+	if err := r.reader.List(context.Background(), podStatuses); err != nil {
+		log.Errorf("failed to list secretproviderclasspodstatus objects, err: %v", err)
+		return nil
+	}
+	var requests []reconcile.Request
+	seen := make(map[string]bool)
+	for _, podStatus := range podStatuses.Items {
+		if podStatus.Status.SecretProviderClassName != o.Meta.GetName() || podStatus.Status.SecretProviderClassNamespace != o.Meta.GetNamespace() {
+			continue
+		}
+		if !seen[podStatus.Namespace] {
+			seen[podStatus.Namespace] = true
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: podStatus.Namespace}})
+		}
+	}
+	return requests
+}
+
+// Reconcile syncs the K8s secrets of the secretproviderclass objects used by
+// the volumes mounted in the namespace and deletes the K8s secrets of the
+// secretproviderclass objects no volume uses anymore
+func (r *secretSyncReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	namespace := req.Name
+
+	podStatuses, err := r.listPodStatuses(ctx, namespace)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// group the volumes by secretproviderclass, the pod namespace or the
+	// shared namespace
+	var secretProviderClasses []types.NamespacedName
+	volumes := make(map[types.NamespacedName][]spcv1alpha1.SecretProviderClassPodStatus)
+	for _, podStatus := range podStatuses {
+		spc := types.NamespacedName{Namespace: podStatus.Status.SecretProviderClassNamespace, Name: podStatus.Status.SecretProviderClassName}
+		if _, ok := volumes[spc]; !ok {
+			secretProviderClasses = append(secretProviderClasses, spc)
+		}
+		volumes[spc] = append(volumes[spc], podStatus)
+	}
+
+	// a secretproviderclass failing to sync doesn't hold up the others
+	var errs []error
+	inUse := make(map[string]bool)
+	for _, spc := range secretProviderClasses {
+		inUse[spc.String()] = true
+		if err := r.syncK8sSecrets(ctx, namespace, spc, volumes[spc]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := deleteK8sSecrets(ctx, r.client, namespace, inUse); err != nil {
+		errs = append(errs, err)
+	}
+	return reconcile.Result{}, utilerrors.NewAggregate(errs)
+}
+
+// syncK8sSecrets syncs the K8s secrets of the secretproviderclass in the
+// namespace from the content secret written last by the nodes of its volumes.
+// The secrets are owned by the pods of all volumes.
+func (r *secretSyncReconciler) syncK8sSecrets(ctx context.Context, namespace string, spc types.NamespacedName, podStatuses []spcv1alpha1.SecretProviderClassPodStatus) error {
+	item, err := getSecretProviderClass(ctx, r.reader, spc.Name, spc.Namespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Infof("secretproviderclass %s not found, skipping secret sync for ns: %s", spc, namespace)
+			return nil
+		}
+		return err
+	}
+	secretObjects := item.Spec.SecretObjects
+	if len(secretObjects) == 0 {
+		return nil
+	}
+
+	var source *spcv1alpha1.SecretProviderClassPodStatus
+	var owners []metav1.OwnerReference
+	for i, podStatus := range podStatuses {
+		if len(podStatus.Status.ContentSecretName) > 0 && (source == nil || isNewerContentSecret(&podStatus, source)) {
+			source = &podStatuses[i]
+		}
+		for _, ref := range podStatus.OwnerReferences {
+			if ref.APIVersion == "v1" && ref.Kind == "Pod" && !hasOwner(owners, ref.UID) {
+				owners = append(owners, newPodOwnerReference(ref.Name, string(ref.UID)))
+			}
+		}
+	}
+	// the node reports the content secret along with the volume, volumes
+	// published in inline mode don't have one
+	if source == nil {
+		log.Debugf("no content secret reported for secretproviderclass %s, ns: %s", spc, namespace)
+		return nil
+	}
+	events := eventObjects(source.Status.PodName, namespace, source.Labels[spcv1alpha1.PodUIDLabel], spc.Name, spc.Namespace)
+
+	contents, err := getContentSecret(ctx, r.client, namespace, source.Status.ContentSecretName)
+	if err != nil {
+		log.Errorf("failed to get content secret %s, err: %v for secretproviderclass: %s, ns: %s", source.Status.ContentSecretName, err, spc, namespace)
+		return err
+	}
+	r.recordMissingObjects(events, contents, secretObjects)
+	err = syncK8sObjects(ctx, r.client, contents, namespace, spc, owners, secretObjects)
+	metrics.ReportK8sSecretSync(string(item.Spec.Provider), namespace, err)
+	if err != nil {
+		r.recordForeignSecret(events, err)
+		log.Errorf("syncK8sObjects err: %v for secretproviderclass: %s, ns: %s", err, spc, namespace)
+		// the secret is synced again when the foreign secret is adopted or
+		// the secretproviderclass changes
+		if _, ok := err.(*foreignSecretError); ok {
+			return nil
+		}
+		return err
+	}
+	log.Infof("synced secrets of secretproviderclass %s from content secret %s, version %s, updated at %v for ns: %s", spc, source.Status.ContentSecretName, source.Status.ContentSecretVersion, source.Status.ContentSecretUpdateTime, namespace)
+	return nil
+}
+
+// isNewerContentSecret returns true if the content secret of the
+// secretproviderclasspodstatus object was written after the one of the
+// other. Content secrets without update time are the oldest.
+func isNewerContentSecret(podStatus, other *spcv1alpha1.SecretProviderClassPodStatus) bool {
+	updateTime, otherUpdateTime := podStatus.Status.ContentSecretUpdateTime, other.Status.ContentSecretUpdateTime
+	if updateTime == nil {
+		return false
+	}
+	return otherUpdateTime == nil || otherUpdateTime.Before(updateTime)
+}
+
+// listPodStatuses returns the secretproviderclasspodstatus objects of the
+// volumes mounted in the namespace ordered by name
+func (r *secretSyncReconciler) listPodStatuses(ctx context.Context, namespace string) ([]spcv1alpha1.SecretProviderClassPodStatus, error) {
+	list := &spcv1alpha1.SecretProviderClassPodStatusList{}
+	if err := r.reader.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var podStatuses []spcv1alpha1.SecretProviderClassPodStatus
+	for _, podStatus := range list.Items {
+		if len(podStatus.Status.SecretProviderClassName) > 0 && podStatus.Status.Mounted {
+			podStatuses = append(podStatuses, podStatus)
+		}
+	}
+	sort.Slice(podStatuses, func(i, j int) bool {
+		return podStatuses[i].Name < podStatuses[j].Name
+	})
+	return podStatuses, nil
+}
+
+// deleteK8sSecrets deletes the K8s secrets in the namespace synced from
+// secretproviderclass objects that aren't in use. The secretproviderclass of
+// a secret is the namespace/name in its annotation. Retained secrets aren't
+// owned by pods and are kept.
+func deleteK8sSecrets(ctx context.Context, c client.Client, namespace string, inUse map[string]bool) error {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.InNamespace(namespace), client.MatchingLabels{spcv1alpha1.ManagedLabel: "true"}); err != nil {
+		return err
+	}
+	for _, secret := range secrets.Items {
+		source := secret.Annotations[spcv1alpha1.SecretProviderClassAnnotation]
+		if len(source) == 0 || inUse[source] {
+			continue
+		}
+		if !isOwnedByPods(&secret) {
+			continue
+		}
+		if err := deleteK8sSecret(ctx, c, secret.Name, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isOwnedByPods returns true if the K8s secret has pod owner references
+func isOwnedByPods(secret *corev1.Secret) bool {
+	for _, ref := range secret.OwnerReferences {
+		if ref.APIVersion == "v1" && ref.Kind == "Pod" {
+			return true
+		}
+	}
+	return false
+}
+
+// getSyncedContents returns the contents of the objects synced to K8s
+// secrets. Objects that aren't synced never leave the node.
+func getSyncedContents(contents map[string][]byte, secretObjects []spcv1alpha1.SecretObject) map[string][]byte {
+	synced := make(map[string][]byte)
+	for _, secretObject := range secretObjects {
+		for _, secretObjectData := range secretObject.Data {
+			if data, found := contents[secretObjectData.ObjectName]; found {
+				synced[secretObjectData.ObjectName] = data
+			}
+		}
+	}
+	return synced
+}
+
+// writeContentSecret writes the content of the files mounted in the target
+// path of the volume to its content secret
+func (ns *nodeServer) writeContentSecret(ctx context.Context, vol *publishedVolume, files []*v1alpha1.File, secretObjects []spcv1alpha1.SecretObject) error {
+	contents, err := getFileContents(vol.TargetPath, files)
+	if err != nil {
+		return err
+	}
+	return writeContentSecret(ctx, ns.client, vol, ns.nodeID, contents, secretObjects)
+}
+
+// writeContentSecret writes the mounted content of the objects synced to K8s
+// secrets to the content secret of the volume and sets the name, resource
+// version and update time of the secret in the volume. The secret is named and
+// owned like the secretproviderclasspodstatus object of the volume. It's only
+// updated when the content changes, so the resource version and update time
+// change with the content whether or not the provider reports object versions.
+func writeContentSecret(ctx context.Context, c client.Client, vol *publishedVolume, nodeID string, contents map[string][]byte, secretObjects []spcv1alpha1.SecretObject) error {
+	data, err := json.Marshal(getSyncedContents(contents, secretObjects))
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getPodStatusName(vol.PodUID, vol.VolumeID),
+			Namespace: vol.PodNamespace,
+			Labels: map[string]string{
+				spcv1alpha1.InternalNodeLabel:  nodeID,
+				spcv1alpha1.ContentSecretLabel: "true",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				newPodOwnerReference(vol.PodName, vol.PodUID),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{contentSecretKey: data},
+	}
+	var version string
+	updateTime := vol.ContentSecretUpdateTime
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current := &corev1.Secret{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}, current)
+		if errors.IsNotFound(err) {
+			created := secret.DeepCopy()
+			if err := c.Create(ctx, created); err != nil {
+				return err
+			}
+			log.Infof("created content secret %s for pod: %s, ns: %s", secret.Name, vol.PodUID, vol.PodNamespace)
+			version = created.ResourceVersion
+			updateTime = newTime()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.Labels[spcv1alpha1.ContentSecretLabel] != "true" {
+			return fmt.Errorf("secret %s/%s exists and is not a content secret of the driver", secret.Namespace, secret.Name)
+		}
+		if bytes.Equal(current.Data[contentSecretKey], data) {
+			version = current.ResourceVersion
+			// the volume was published again, e.g. after a driver restart
+			if updateTime == nil {
+				updateTime = newTime()
+			}
+			return nil
+		}
+		current.Data = secret.Data
+		if err := c.Update(ctx, current); err != nil {
+			return err
+		}
+		log.Infof("updated content secret %s for pod: %s, ns: %s", secret.Name, vol.PodUID, vol.PodNamespace)
+		version = current.ResourceVersion
+		updateTime = newTime()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	vol.ContentSecretName = secret.Name
+	vol.ContentSecretVersion = version
+	vol.ContentSecretUpdateTime = updateTime
+	return nil
+}
+
+// newTime returns the current time
+func newTime() *metav1.Time {
+	now := metav1.Now()
+	return &now
+}
+
+// getContentSecret returns the contents of the synced objects written to the
+// content secret by the node
+func getContentSecret(ctx context.Context, c client.Reader, namespace, name string) (map[string][]byte, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, err
+	}
+	if secret.Labels[spcv1alpha1.ContentSecretLabel] != "true" {
+		return nil, fmt.Errorf("secret %s/%s is not a content secret of the driver", namespace, name)
+	}
+	contents := make(map[string][]byte)
+	if err := json.Unmarshal(secret.Data[contentSecretKey], &contents); err != nil {
+		return nil, fmt.Errorf("failed to decode content secret %s/%s, err: %v", namespace, name, err)
+	}
+	return contents, nil
+}
+
+// deleteContentSecret deletes the content secret of a volume
+func deleteContentSecret(ctx context.Context, c client.Client, namespace, name string) error {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if secret.Labels[spcv1alpha1.ContentSecretLabel] != "true" {
+		log.Infof("secret %s is not a content secret of the driver. Skip. ns: %s", name, namespace)
+		return nil
+	}
+	if err := c.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	log.Infof("deleted content secret %s, ns: %s", name, namespace)
+	return nil
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/mount"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func TestSecretSyncReconcile(t *testing.T) {
+	ctx := context.Background()
+	secretObjects := []spcv1alpha1.SecretObject{
+		{
+			SecretName: "secret1",
+			Type:       "Opaque",
+			Data:       []spcv1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}},
+		},
+		{
+			SecretName:     "secret2",
+			Type:           "Opaque",
+			Data:           []spcv1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}},
+			DeletionPolicy: spcv1alpha1.DeletionPolicyRetain,
+		},
+	}
+	spc := &spcv1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: spcv1alpha1.SecretProviderClassSpec{
+			Provider:      "provider1",
+			SecretObjects: secretObjects,
+		},
+	}
+	// a secret of the secretproviderclass with the same name in the shared
+	// namespace, which no volume uses anymore
+	shared := newK8sSecret("secret3", "default", map[string][]byte{"key1": []byte("shared")}, corev1.SecretTypeOpaque, types.NamespacedName{Namespace: "shared", Name: "spc1"})
+	shared.OwnerReferences = []metav1.OwnerReference{newPodOwnerReference("pod3", "uid3")}
+
+	vol1 := publishedVolume{
+		VolumeID:                     "vol1",
+		PodName:                      "pod1",
+		PodNamespace:                 "default",
+		PodUID:                       "uid1",
+		SecretProviderClass:          "spc1",
+		SecretProviderClassNamespace: "default",
+	}
+	c := fake.NewFakeClientWithScheme(scheme, spc, shared)
+	assert.NoError(t, writeContentSecret(ctx, c, &vol1, "node1", map[string][]byte{"object1": []byte("secret")}, secretObjects))
+	pod1 := newPodStatus(vol1, "node1")
+	// the volume of pod2 was published without a content secret, e.g. by a
+	// driver in inline mode
+	pod2 := newPodStatus(publishedVolume{
+		VolumeID:                     "vol1",
+		PodName:                      "pod2",
+		PodNamespace:                 "default",
+		PodUID:                       "uid2",
+		SecretProviderClass:          "spc1",
+		SecretProviderClassNamespace: "default",
+	}, "node2")
+	assert.NoError(t, c.Create(ctx, pod1))
+	assert.NoError(t, c.Create(ctx, pod2))
+
+	r := &secretSyncReconciler{client: c, reader: c}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "default"}}
+
+	// the secrets are synced from the content secret and owned by all pods
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	secret := &corev1.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret1"}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), secret.Data["key1"])
+	assert.ElementsMatch(t, []metav1.OwnerReference{newPodOwnerReference("pod1", "uid1"), newPodOwnerReference("pod2", "uid2")}, secret.OwnerReferences)
+	// only the secrets of the secretproviderclass in the other namespace are
+	// deleted
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret3"}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// rotated content is synced even without object versions
+	assert.NoError(t, writeContentSecret(ctx, c, &vol1, "node1", map[string][]byte{"object1": []byte("rotated")}, secretObjects))
+	assert.NoError(t, createOrUpdatePodStatus(ctx, c, vol1, "node1"))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	secret = &corev1.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret1"}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated"), secret.Data["key1"])
+
+	// the secrets are synced from the content secret written last, whatever
+	// the order of the volumes
+	vol3 := publishedVolume{
+		VolumeID:                     "vol1",
+		PodName:                      "pod3",
+		PodNamespace:                 "default",
+		PodUID:                       "uid0",
+		SecretProviderClass:          "spc1",
+		SecretProviderClassNamespace: "default",
+	}
+	assert.NoError(t, writeContentSecret(ctx, c, &vol3, "node3", map[string][]byte{"object1": []byte("stale")}, secretObjects))
+	vol3.ContentSecretUpdateTime = &metav1.Time{Time: vol1.ContentSecretUpdateTime.Add(-time.Minute)}
+	pod3 := newPodStatus(vol3, "node3")
+	assert.True(t, pod3.Name < pod1.Name)
+	assert.NoError(t, c.Create(ctx, pod3))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	secret = &corev1.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret1"}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated"), secret.Data["key1"])
+
+	// the secrets owned by the pods are deleted when no volume uses the
+	// secretproviderclass anymore
+	assert.NoError(t, c.Delete(ctx, pod3))
+	assert.NoError(t, c.Delete(ctx, pod1))
+	assert.NoError(t, c.Delete(ctx, pod2))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret1"}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "secret2"}, &corev1.Secret{})
+	assert.NoError(t, err)
+}
+
+func TestWriteContentSecret(t *testing.T) {
+	ctx := context.Background()
+	secretObjects := []spcv1alpha1.SecretObject{
+		{
+			SecretName: "secret1",
+			Data:       []spcv1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}},
+		},
+	}
+	vol := publishedVolume{
+		VolumeID:     "vol1",
+		PodName:      "pod1",
+		PodNamespace: "default",
+		PodUID:       "uid1",
+	}
+	c := &updateCountingClient{Client: fake.NewFakeClientWithScheme(scheme)}
+
+	// only the synced objects are written to the content secret
+	contents := map[string][]byte{"object1": []byte("secret"), "object2": []byte("not synced")}
+	assert.NoError(t, writeContentSecret(ctx, c, &vol, "node1", contents, secretObjects))
+	assert.Equal(t, getPodStatusName("uid1", "vol1"), vol.ContentSecretName)
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: vol.ContentSecretName}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{spcv1alpha1.InternalNodeLabel: "node1", spcv1alpha1.ContentSecretLabel: "true"}, secret.Labels)
+	assert.Equal(t, []metav1.OwnerReference{newPodOwnerReference("pod1", "uid1")}, secret.OwnerReferences)
+	synced, err := getContentSecret(ctx, c, "default", vol.ContentSecretName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"object1": []byte("secret")}, synced)
+	assert.Equal(t, newPodStatus(vol, "node1").Status.ContentSecretName, vol.ContentSecretName)
+
+	// the secret is only updated when the content changes
+	assert.NoError(t, writeContentSecret(ctx, c, &vol, "node1", contents, secretObjects))
+	assert.Equal(t, 0, c.updates)
+	contents["object1"] = []byte("rotated")
+	assert.NoError(t, writeContentSecret(ctx, c, &vol, "node1", contents, secretObjects))
+	assert.Equal(t, 1, c.updates)
+
+	// secrets that aren't content secrets are neither read, overwritten nor
+	// deleted
+	foreign := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: getPodStatusName("uid2", "vol1"), Namespace: "default"}}
+	assert.NoError(t, c.Create(ctx, foreign))
+	_, err = getContentSecret(ctx, c, "default", foreign.Name)
+	assert.Error(t, err)
+	vol.PodUID = "uid2"
+	assert.Error(t, writeContentSecret(ctx, c, &vol, "node1", contents, secretObjects))
+	assert.NoError(t, deleteContentSecret(ctx, c, "default", foreign.Name))
+	assert.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: foreign.Name}, &corev1.Secret{}))
+
+	assert.NoError(t, deleteContentSecret(ctx, c, "default", getPodStatusName("uid1", "vol1")))
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "vol1")}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestSecretSyncRequests(t *testing.T) {
+	podStatus := newPodStatus(publishedVolume{
+		PodName:                      "pod1",
+		PodNamespace:                 "default",
+		PodUID:                       "uid1",
+		SecretProviderClass:          "spc1",
+		SecretProviderClassNamespace: "shared",
+	}, "node1")
+	expected := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "default"}}}
+	assert.Equal(t, expected, podStatusRequests(handler.MapObject{Meta: podStatus, Object: podStatus}))
+
+	r := &secretSyncReconciler{reader: fake.NewFakeClientWithScheme(scheme, podStatus)}
+	spc := &spcv1alpha1.SecretProviderClass{ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "shared"}}
+	assert.Equal(t, expected, r.secretProviderClassRequests(handler.MapObject{Meta: spc, Object: spc}))
+	spc = &spcv1alpha1.SecretProviderClass{ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"}}
+	assert.Empty(t, r.secretProviderClassRequests(handler.MapObject{Meta: spc, Object: spc}))
+}
+
+// secretCreateErrorClient fails to create secrets with err, if set
+type secretCreateErrorClient struct {
+	client.Client
+	err error
+}
+
+func (c *secretCreateErrorClient) Create(ctx context.Context, obj k8sruntime.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*corev1.Secret); ok && c.err != nil {
+		return c.err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestNodePublishVolumeContentSecretError(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	server := newFakeProviderServer(t, filepath.Join(providerDir, "fakeprovider.sock"), &fakeProviderServer{})
+	defer server.Stop()
+
+	spc := &spcv1alpha1.SecretProviderClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "default"},
+		Spec: spcv1alpha1.SecretProviderClassSpec{
+			Provider:   "fakeprovider",
+			Parameters: map[string]string{"objects": "object1"},
+			SecretObjects: []spcv1alpha1.SecretObject{
+				{SecretName: "secret1", Type: "Opaque", Data: []spcv1alpha1.SecretObjectData{{ObjectName: "object1", Key: "key1"}}},
+			},
+		},
+	}
+	c := &secretCreateErrorClient{Client: fake.NewFakeClientWithScheme(scheme, spc), err: fmt.Errorf("unavailable")}
+	recorder := record.NewFakeRecorder(10)
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir, SecretSyncMode: secretSyncModeController}, c, c, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	ns.mounter = &mount.FakeMounter{}
+
+	// failing to write the content secret doesn't fail the mount
+	_, err = ns.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+		VolumeId:         "csi-vol1",
+		TargetPath:       targetPath,
+		VolumeCapability: &csi.VolumeCapability{AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}}},
+		Readonly:         true,
+		VolumeContext: map[string]string{
+			secretProviderClassField: "spc1",
+			csipodname:               "pod1",
+			csipodnamespace:          "default",
+			csipoduid:                "uid1",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Warning ContentSecretError failed to write content secret, err: unavailable", <-recorder.Events)
+	podStatus := &spcv1alpha1.SecretProviderClassPodStatus{}
+	err = c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "csi-vol1")}, podStatus)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"object1"}, podStatus.Status.Files)
+	assert.Empty(t, podStatus.Status.ContentSecretName)
+
+	// the content secret is written when the volume is rotated, even if the
+	// objects didn't change
+	c.err = nil
+	ns.rotateSecrets(context.Background())
+	err = c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: getPodStatusName("uid1", "csi-vol1")}, podStatus)
+	assert.NoError(t, err)
+	assert.Equal(t, getPodStatusName("uid1", "csi-vol1"), podStatus.Status.ContentSecretName)
+	assert.NotNil(t, podStatus.Status.ContentSecretUpdateTime)
+	contents, err := getContentSecret(context.Background(), c, "default", podStatus.Status.ContentSecretName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"object1": []byte("secret")}, contents)
+}
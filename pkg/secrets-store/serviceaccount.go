@@ -0,0 +1,88 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// serviceAccountToken is a token of the pod service account requested by
+// kubelet for an audience in the tokenRequests of the CSIDriver
+type serviceAccountToken struct {
+	Token               string    `json:"token"`
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+}
+
+// parseServiceAccountTokens returns the service account tokens in the
+// csi.storage.k8s.io/serviceAccount.tokens volume context keyed by audience
+func parseServiceAccountTokens(tokens string) (map[string]serviceAccountToken, error) {
+	parsed := make(map[string]serviceAccountToken)
+	if len(tokens) == 0 {
+		return parsed, nil
+	}
+	if err := json.Unmarshal([]byte(tokens), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse %s, err: %v", csipodsatokens, err)
+	}
+	return parsed, nil
+}
+
+// getSecretValues returns the values of the nodePublishSecretRef and the
+// service account tokens of a volume, which must not be logged or recorded
+func getSecretValues(secrets map[string]string, serviceAccountTokens string) []string {
+	var values []string
+	for _, secret := range secrets {
+		values = append(values, secret)
+	}
+	// the tokens are validated before the provider is called
+	tokens, _ := parseServiceAccountTokens(serviceAccountTokens)
+	for _, token := range tokens {
+		values = append(values, token.Token)
+	}
+	return values
+}
+
+// withoutServiceAccountTokens returns a copy of the volume context or the
+// parameters without the service account tokens
+func withoutServiceAccountTokens(attrib map[string]string) map[string]string {
+	copied := make(map[string]string, len(attrib))
+	for k, v := range attrib {
+		if k != csipodsatokens {
+			copied[k] = v
+		}
+	}
+	return copied
+}
+
+// removeServiceAccountTokens removes the service account tokens from the JSON
+// encoded parameters passed to a provider. It returns true if the parameters
+// contained tokens.
+func removeServiceAccountTokens(parameters string) (string, bool, error) {
+	var params map[string]string
+	if err := json.Unmarshal([]byte(parameters), &params); err != nil {
+		return "", false, err
+	}
+	if _, ok := params[csipodsatokens]; !ok {
+		return parameters, false, nil
+	}
+	data, err := json.Marshal(withoutServiceAccountTokens(params))
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/utils/mount"
+)
+
+func TestParseServiceAccountTokens(t *testing.T) {
+	tokens, err := parseServiceAccountTokens(`{"vault":{"token":"token1","expirationTimestamp":"2020-07-01T10:00:00Z"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]serviceAccountToken{
+		"vault": {Token: "token1", ExpirationTimestamp: time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)},
+	}, tokens)
+
+	tokens, err = parseServiceAccountTokens("")
+	assert.NoError(t, err)
+	assert.Empty(t, tokens)
+
+	_, err = parseServiceAccountTokens("invalid")
+	assert.Error(t, err)
+}
+
+func TestGetSecretValues(t *testing.T) {
+	values := getSecretValues(map[string]string{"clientsecret": "s3cr3t"}, `{"vault":{"token":"token1"},"azure":{"token":"token2"}}`)
+	assert.ElementsMatch(t, []string{"s3cr3t", "token1", "token2"}, values)
+}
+
+func TestNodePublishVolumeServiceAccountTokens(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	provider := &fakeProviderServer{}
+	server := newFakeProviderServer(t, filepath.Join(providerDir, "fakeprovider.sock"), provider)
+	defer server.Stop()
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	ns.mounter = &mount.FakeMounter{}
+
+	tokens := `{"vault":{"token":"token1","expirationTimestamp":"2020-07-01T10:00:00Z"}}`
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:   "vol1",
+		TargetPath: targetPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		},
+		Readonly: true,
+		VolumeContext: map[string]string{
+			"providerName":  "fakeprovider",
+			csipodname:      "pod1",
+			csipodnamespace: "default",
+			csipoduid:       "pod1",
+			csipodsa:        "sa1",
+			csipodsatokens:  tokens,
+		},
+	}
+	_, err = ns.NodePublishVolume(context.Background(), req)
+	assert.NoError(t, err)
+
+	// the tokens are passed to the provider, but not persisted
+	var attributes map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(provider.lastAttributes()), &attributes))
+	assert.Equal(t, "sa1", attributes[csipodsa])
+	assert.Equal(t, tokens, attributes[csipodsatokens])
+	vol, ok := ns.volumes.get(targetPath)
+	assert.True(t, ok)
+	assert.Equal(t, "sa1", vol.ServiceAccountName)
+	assert.Equal(t, tokens, vol.ServiceAccountTokens)
+	assert.True(t, vol.HasServiceAccountTokens)
+	assert.NotContains(t, vol.Parameters, csipodsatokens)
+
+	// republishing the mounted volume refreshes the tokens
+	refreshed := `{"vault":{"token":"token2","expirationTimestamp":"2020-07-01T11:00:00Z"}}`
+	req.VolumeContext[csipodsatokens] = refreshed
+	_, err = ns.NodePublishVolume(context.Background(), req)
+	assert.NoError(t, err)
+	vol, _ = ns.volumes.get(targetPath)
+	assert.Equal(t, refreshed, vol.ServiceAccountTokens)
+
+	// volumes with unknown tokens, e.g. recovered after a restart, aren't
+	// rotated
+	ns.volumes.setServiceAccountTokens(targetPath, "")
+	vol, _ = ns.volumes.get(targetPath)
+	result, err := ns.rotateVolume(context.Background(), vol)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	req.VolumeContext[csipodsatokens] = "invalid"
+	_, err = ns.NodePublishVolume(context.Background(), req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -17,18 +17,25 @@ limitations under the License.
 package secretsstore
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"time"
 
+	"github.com/ghodss/yaml"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
@@ -37,31 +44,34 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/jsonpath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
-)
 
-var (
-	secretProviderClassGvk = schema.GroupVersionKind{
-		Group:   "secrets-store.csi.x-k8s.io",
-		Version: "v1alpha1",
-		Kind:    "SecretProviderClassList",
-	}
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/fileutil"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
 )
 
+// scheme contains the K8s types and the secretproviderclass types used by the
+// driver
+var scheme = k8sruntime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = spcv1alpha1.AddToScheme(scheme)
+}
+
 const (
-	secretNameField    = "secretName"
-	secretObjectsField = "secretObjects"
-	keyField           = "key"
-	dataField          = "data"
-	objectNameField    = "objectName"
-	typeField          = "type"
-	certType           = "CERTIFICATE"
-	privateKeyType     = "RSA PRIVATE KEY"
+	certType         = "CERTIFICATE"
+	privateKeyType   = "RSA PRIVATE KEY"
+	ecPrivateKeyType = "EC PRIVATE KEY"
+	ecParametersType = "EC PARAMETERS"
+	// caCertKey is the key of the issuing certificates in K8s TLS secrets
+	caCertKey = "ca.crt"
 )
 
 // getProviderPath returns the absolute path to the provider binary
@@ -80,7 +90,44 @@ func normalizeWindowsPath(path string) string {
 	return normalizedPath
 }
 
-// getMountedFiles returns all the mounted files names
+// getProviderTimeouts creates a map with provider name and the timeout of a
+// single call to the provider from a comma delimited list of provider=duration
+func getProviderTimeouts(providerTimeouts string) (map[string]time.Duration, error) {
+	providerTimeoutMap := make(map[string]time.Duration)
+
+	if providerTimeouts == "" {
+		return providerTimeoutMap, nil
+	}
+
+	for _, p := range strings.Split(providerTimeouts, ",") {
+		pt := strings.Split(strings.TrimSpace(p), "=")
+		if len(pt) != 2 {
+			return providerTimeoutMap, fmt.Errorf("provider timeout not defined in expected format provider=duration, got %+v", pt)
+		}
+
+		provider := strings.TrimSpace(pt[0])
+		timeout := strings.TrimSpace(pt[1])
+		if len(provider) == 0 || len(timeout) == 0 {
+			return providerTimeoutMap, fmt.Errorf("provider timeout not defined in expected format provider=duration, got provider %s timeout %s", provider, timeout)
+		}
+		if _, exists := providerTimeoutMap[provider]; exists {
+			return providerTimeoutMap, fmt.Errorf("duplicate timeouts defined for %s provider", provider)
+		}
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return providerTimeoutMap, fmt.Errorf("%s provider timeout %s is not a valid duration, error %+v", provider, timeout, err)
+		}
+		if d <= 0 {
+			return providerTimeoutMap, fmt.Errorf("%s provider timeout %s must be greater than 0", provider, timeout)
+		}
+		providerTimeoutMap[provider] = d
+	}
+	return providerTimeoutMap, nil
+}
+
+// getMountedFiles returns all the user visible mounted files names. The
+// hidden entries used to atomically swap the content, e.g. ..data, are
+// skipped.
 func getMountedFiles(targetPath string) ([]string, error) {
 	var paths []string
 	// loop thru all the mounted files
@@ -97,11 +144,38 @@ func getMountedFiles(targetPath string) ([]string, error) {
 		sep = `\`
 	}
 	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "..") {
+			continue
+		}
 		paths = append(paths, targetPath+sep+file.Name())
 	}
 	return paths, nil
 }
 
+// getFilePaths returns the paths of the files relative to the target path
+func getFilePaths(files []*v1alpha1.File) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.GetPath())
+	}
+	return paths
+}
+
+// removeTargetPathContents removes all the content in the target path,
+// including the hidden generations of the mounted files
+func removeTargetPathContents(targetPath string) error {
+	files, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.RemoveAll(filepath.Join(targetPath, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // getPodUIDFromTargetPath returns podUID from targetPath
 func getPodUIDFromTargetPath(goos string, targetPath string) string {
 	var parts []string
@@ -164,109 +238,86 @@ func (ns *nodeServer) ensureMountPoint(target string) (bool, error) {
 	return false, nil
 }
 
-// syncK8sObjects creates or updates K8s secrets based on secretProviderClass spec and data from mounted files in targetPath
-// it should also add pod info to the secretProviderClass object's byPod status field
-func syncK8sObjects(ctx context.Context, targetPath string, podUID string, namespace string, secretProviderClass string, secretObjects []interface{}) error {
-	successfulUpdates := 0
-	files, err := getMountedFiles(targetPath)
+// getFileContents returns the contents of the mounted files keyed by the file
+// path relative to targetPath. Files returned by the provider are used as-is,
+// otherwise the files in the current generation in targetPath are read.
+func getFileContents(targetPath string, files []*v1alpha1.File) (map[string][]byte, error) {
+	contents := make(map[string][]byte)
+	if len(files) > 0 {
+		for _, file := range files {
+			contents[filepath.ToSlash(filepath.Clean(file.GetPath()))] = file.GetContents()
+		}
+		return contents, nil
+	}
+	// resolve the current generation once so all files are read from the
+	// same generation even if the content is swapped while reading
+	dir := targetPath
+	if generation, err := os.Readlink(filepath.Join(targetPath, fileutil.DataDirName)); err == nil {
+		dir = filepath.Join(targetPath, generation)
+	}
+	paths, err := getMountedFiles(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, s := range secretObjects {
-		secretObject, ok := s.(map[string]interface{})
-		if !ok {
-			log.Infof("could not cast secretObject as map[string]interface{} for pod: %s, ns: %s", podUID, namespace)
-			continue
-		}
-		secretName, err := getStringFromObject(secretObject, secretNameField)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
-			log.Infof("could not get secretName from secretObject for pod: %s, ns: %s", podUID, namespace)
-			continue
-		}
-		sType, err := getStringFromObject(secretObject, typeField)
-		if err != nil {
-			log.Infof("could not get type from secretObject for pod: %s, ns: %s", podUID, namespace)
-			continue
-		}
-		secretType := getSecretType(sType)
-		secretObjectDataList, err := getSliceFromObject(secretObject, dataField)
-		if err != nil {
-			log.Infof("could not get data from secretObject for pod: %s, ns: %s", podUID, namespace)
-			continue
+			log.Errorf("failed to read file %s, err: %v", path, err)
+			return nil, status.Error(codes.Internal, err.Error())
 		}
+		contents[filepath.Base(path)] = data
+	}
+	return contents, nil
+}
+
+// syncK8sObjects creates or updates K8s secrets based on secretProviderClass spec and the contents of the mounted files
+// The secrets are owned by the pods using them unless they're retained.
+func syncK8sObjects(ctx context.Context, c client.Client, contents map[string][]byte, namespace string, secretProviderClass types.NamespacedName, owners []metav1.OwnerReference, secretObjects []spcv1alpha1.SecretObject) error {
+	for _, secretObject := range secretObjects {
+		secretName := secretObject.SecretName
+		secretType := getSecretType(secretObject.Type)
 		datamap := make(map[string][]byte)
-		for _, d := range secretObjectDataList {
-			secretObjectData, ok := d.(map[string]interface{})
-			if !ok {
-				log.Infof("could not cast secretObject data as map[string]interface{} for pod: %s, ns: %s", podUID, namespace)
-				continue
-			}
-			objectName, err := getStringFromObject(secretObjectData, objectNameField)
-			if err != nil {
-				log.Infof("could not get objectName from secretObject data for pod: %s, ns: %s", podUID, namespace)
-				continue
+		for _, secretObjectData := range secretObject.Data {
+			objectName := secretObjectData.ObjectName
+			key := secretObjectData.Key
+			data, found := contents[objectName]
+			if !found {
+				log.Errorf("file matching objectName %s not found for secretproviderclass: %s, ns: %s", objectName, secretProviderClass, namespace)
+				return status.Errorf(codes.InvalidArgument, "file matching objectName %s of key %s of secret %s not found", objectName, key, secretName)
 			}
-			key, err := getStringFromObject(secretObjectData, keyField)
+			log.Infof("file matching objectName %s found, processing key %s for secretproviderclass: %s, ns: %s", objectName, key, secretProviderClass, namespace)
+			data, err := getSecretObjectData(data, secretObjectData)
 			if err != nil {
-				log.Infof("could not get key from secretObject data for pod: %s, ns: %s", podUID, namespace)
-				continue
+				log.Errorf("failed to get key %s of secret %s from objectName %s, err: %v for secretproviderclass: %s, ns: %s", key, secretName, objectName, err, secretProviderClass, namespace)
+				return status.Errorf(codes.InvalidArgument, "failed to get key %s of secret %s from objectName %s, err: %v", key, secretName, objectName, err)
 			}
-			found := false
-			for _, file := range files {
-				filename := filepath.Base(file)
-				if filename == objectName {
-					found = true
-					log.Infof("file matching objectName %s found, processing key %s for pod: %s, ns: %s", objectName, key, podUID, namespace)
-					data, err := ioutil.ReadFile(file)
-					if err != nil {
-						log.Errorf("failed to read file %s, err: %v for pod: %s, ns: %s", file, err, podUID, namespace)
-						return status.Error(codes.Internal, err.Error())
-					}
-					if secretType == corev1.SecretTypeTLS {
-						data, err = getCertPart(data, key)
-						if err != nil {
-							log.Errorf("failed to get cert data from file %s, err: %v for pod: %s, ns: %s", file, err, podUID, namespace)
-							return status.Error(codes.Internal, err.Error())
-						}
-					}
-					datamap[key] = data
-					break
+			if secretType == corev1.SecretTypeTLS {
+				data, err = getCertPart(data, key)
+				if err != nil {
+					log.Errorf("failed to get cert data from objectName %s, err: %v for secretproviderclass: %s, ns: %s", objectName, err, secretProviderClass, namespace)
+					return status.Error(codes.Internal, err.Error())
 				}
 			}
-			if !found {
-				log.Errorf("file matching objectName %s not found for pod: %s, ns: %s", objectName, podUID, namespace)
-			}
+			datamap[key] = data
 		}
-		createFn := func() (bool, error) {
-			if err := createOrUpdateK8sSecret(ctx, secretName, namespace, datamap, secretType); err != nil {
-				log.Errorf("failed createOrUpdateK8sSecret, err: %v for pod: %s, ns: %s", err, podUID, namespace)
-				return false, nil
+		if secretType == corev1.SecretTypeTLS {
+			if err := validateKeyPair(datamap); err != nil {
+				log.Errorf("invalid tls secret %s, err: %v for secretproviderclass: %s, ns: %s", secretName, err, secretProviderClass, namespace)
+				return status.Errorf(codes.Internal, "invalid tls secret %s, err: %v", secretName, err)
 			}
-			successfulUpdates++
-			return true, nil
 		}
-		if err := wait.ExponentialBackoff(wait.Backoff{
-			Steps:    5,
-			Duration: 1 * time.Millisecond,
-			Factor:   1.0,
-			Jitter:   0.1,
-		}, createFn); err != nil {
-			log.Error(err, "max retries for creating secret reached for pod: %s, ns: %s", podUID, namespace)
-			return err
+		secret := newK8sSecret(secretName, namespace, datamap, secretType, secretProviderClass)
+		secretOwners := owners
+		if isRetained(secretObject) {
+			secretOwners = nil
 		}
-	}
-	// only update status when more than one secret has been created
-	if successfulUpdates > 0 {
-		/// TODO(ritazh): right now assume all files come from one secretproviderclass
-		// update instance status field with podUID and namespace
-		setStatusFn := func() (bool, error) {
-			item, err := getSecretProviderItemByName(ctx, secretProviderClass)
-			if err != nil {
-				log.Errorf("failed to get secret provider item, err: %v for pod: %s, ns: %s", err, podUID, namespace)
-				return false, nil
-			}
-			if err := setStatus(ctx, item, podUID, namespace); err != nil {
-				log.Errorf("failed to set status, err: %v for pod: %s, ns: %s", err, podUID, namespace)
+		createFn := func() (bool, error) {
+			if err := createOrUpdateK8sSecret(ctx, c, secret, secretOwners); err != nil {
+				log.Errorf("failed createOrUpdateK8sSecret, err: %v for secretproviderclass: %s, ns: %s", err, secretProviderClass, namespace)
+				// retrying doesn't help with secrets the driver doesn't manage
+				if _, ok := err.(*foreignSecretError); ok {
+					return false, err
+				}
 				return false, nil
 			}
 			return true, nil
@@ -276,382 +327,331 @@ func syncK8sObjects(ctx context.Context, targetPath string, podUID string, names
 			Duration: 1 * time.Millisecond,
 			Factor:   1.0,
 			Jitter:   0.1,
-		}, setStatusFn); err != nil {
-			log.Error(err, "max retries for setting status reached for pod: %s, ns: %s", podUID, namespace)
+		}, createFn); err != nil {
+			log.Error(err, "max retries for creating secret reached for secretproviderclass: %s, ns: %s", secretProviderClass, namespace)
 			return err
 		}
 	}
 	return nil
 }
 
-// removeK8sObjects deletes K8s secrets based on secretProviderClass spec
-// it should also delete pod info from the secretProviderClass object's byPod status field
-func removeK8sObjects(ctx context.Context, targetPath string, podUID string, files []string, secretObjects []interface{}) error {
-	var secretProviderClass, namespace string
+// removeK8sObjects deletes the secretproviderclasspodstatus object and the
+// content secret of the pod volume, and the K8s secrets based on
+// secretProviderClass spec when no other pod in the namespace uses the
+// secretproviderclass object
+func removeK8sObjects(ctx context.Context, c client.Client, podStatus *spcv1alpha1.SecretProviderClassPodStatus, secretNames []string) error {
+	namespace := podStatus.Namespace
+	if err := deletePodStatus(ctx, c, podStatus); err != nil {
+		log.Errorf("failed to delete secretproviderclasspodstatus %s, err: %v for ns: %s", podStatus.Name, err, namespace)
+		return err
+	}
+	if contentSecretName := podStatus.Status.ContentSecretName; len(contentSecretName) > 0 {
+		if err := deleteContentSecret(ctx, c, namespace, contentSecretName); err != nil {
+			log.Errorf("failed to delete content secret %s, err: %v for ns: %s", contentSecretName, err, namespace)
+			return err
+		}
+	}
+	if len(secretNames) == 0 {
+		return nil
+	}
 
-	deleteStatusFn := func() (bool, error) {
-		item, podNS, err := getItemWithPodID(ctx, podUID)
-		if err == nil && len(podNS) > 0 {
-			secretProviderClass = item.GetName()
-			namespace = podNS
-			if err = deleteStatus(ctx, item, podUID); err != nil {
+	secretProviderClass := types.NamespacedName{
+		Namespace: podStatus.Status.SecretProviderClassNamespace,
+		Name:      podStatus.Status.SecretProviderClassName,
+	}
+	deleteSecretFn := func() (bool, error) {
+		count, err := getPodStatusCount(ctx, c, namespace, secretProviderClass)
+		if err != nil {
+			log.Errorf("failed to get secretproviderclasspodstatus count, err: %v for ns: %s", err, namespace)
+			return false, nil
+		}
+		// only delete when no more pods in the namespace are associated with it
+		if count > 0 {
+			return true, nil
+		}
+		///TODO: we assume all files are mounted from a single secretsproviderclass
+		/// a pod could have multiple volumes pointing to diff secretproviderclass objs
+		for _, secretName := range secretNames {
+			if err := deleteK8sSecret(ctx, c, secretName, namespace); err != nil {
 				return false, nil
 			}
-			return true, nil
 		}
 		return true, nil
 	}
-
 	if err := wait.ExponentialBackoff(wait.Backoff{
 		Steps:    5,
 		Duration: 1 * time.Millisecond,
 		Factor:   1.0,
 		Jitter:   0.1,
-	}, deleteStatusFn); err != nil {
-		log.Error(err, "max retries for deleting status reached for pod: %s, ns: %s", podUID, namespace)
+	}, deleteSecretFn); err != nil {
+		log.Error(err, "max retries for deleting secret reached for ns: %s", namespace)
 		return err
 	}
-
-	if len(namespace) > 0 && len(secretProviderClass) > 0 {
-		deleteSecretFn := func() (bool, error) {
-			item, err := getSecretProviderItemByName(ctx, secretProviderClass)
-			if err != nil {
-				log.Errorf("failed to get secret provider item, err: %v for pod: %s, ns: %s", err, podUID, namespace)
-				return false, nil
-			}
-			count, err := getStatusCount(item)
-			if err != nil {
-				log.Errorf("failed to get status count, err: %v for object: %s", err, item.GetName())
-				return false, nil
-			}
-			// only delete when no more pods are associated with it
-			if count == 0 {
-				///TODO: we assume all files are mounted from a single secretsproviderclass
-				/// a pod could have multiple volumes pointing to diff secretproviderclass objs
-				for _, s := range secretObjects {
-					secretObject, ok := s.(map[string]interface{})
-					if !ok {
-						continue
-					}
-
-					secretName, err := getStringFromObject(secretObject, secretNameField)
-					if err != nil {
-						continue
-					}
-					err = deleteK8sSecret(ctx, secretName, namespace)
-					if err != nil {
-						return false, nil
-					}
-				}
-			}
-			return true, nil
-		}
-
-		if err := wait.ExponentialBackoff(wait.Backoff{
-			Steps:    5,
-			Duration: 1 * time.Millisecond,
-			Factor:   1.0,
-			Jitter:   0.1,
-		}, deleteSecretFn); err != nil {
-			log.Error(err, "max retries for deleting secret reached for pod: %s, ns: %s", podUID, namespace)
-			return err
-		}
-	}
 	return nil
 }
 
-// createOrUpdateK8sSecret creates or updates a K8s secret with data from mounted files
-// If a secret with the same name already exists in the namespace of the pod, it's updated.
-func createOrUpdateK8sSecret(ctx context.Context, name string, namespace string, datamap map[string][]byte, secretType corev1.SecretType) error {
-	// recreating client here to prevent reading from cache
-	c, err := getClient()
-	if err != nil {
-		return err
-	}
-	secretKey := types.NamespacedName{
-		Namespace: namespace,
-		Name:      name,
-	}
-
-	secret := &corev1.Secret{
+// newK8sSecret returns the K8s secret synced from the mounted files. The
+// secret is labelled as managed by the driver and annotated with the
+// secretproviderclass it's synced from.
+func newK8sSecret(name, namespace string, datamap map[string][]byte, secretType corev1.SecretType, secretProviderClass types.NamespacedName) *corev1.Secret {
+	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: namespace,
 			Name:      name,
+			Labels: map[string]string{
+				spcv1alpha1.ManagedLabel: "true",
+			},
+			Annotations: map[string]string{
+				spcv1alpha1.SecretProviderClassAnnotation: secretProviderClass.String(),
+			},
 		},
 		Type: secretType,
+		Data: datamap,
+	}
+}
+
+// createOrUpdateK8sSecret creates or updates a K8s secret with data from mounted files
+// If a secret with the same name already exists in the namespace of the pod, it's updated
+// if it's managed by the driver or annotated to be adopted by the driver, and
+// its data, labels, annotations or owners change.
+// The secret is owned by the pods using it so it's garbage collected when the
+// last pod is deleted. Secrets without owners are retained, the pod owner
+// references of a secret previously owned by pods are removed.
+func createOrUpdateK8sSecret(ctx context.Context, c client.Client, secret *corev1.Secret, owners []metav1.OwnerReference) error {
+	name, namespace := secret.Name, secret.Namespace
+	secretKey := types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
 	}
 
-	err = c.Get(ctx, secretKey, secret)
+	current := &corev1.Secret{}
+	err := c.Get(ctx, secretKey, current)
 	if err != nil {
 		log.Error(err, "error from c.Get for secret: %s, ns: %s", name, namespace)
 		if errors.IsNotFound(err) {
-			secret.Data = datamap
+			secret = secret.DeepCopy()
+			secret.OwnerReferences = owners
 			if err := c.Create(ctx, secret); err != nil {
 				log.Error(err, "error while creating K8s secret: %s, ns: %s", name, namespace)
 				return err
 			}
+			log.Infof("created k8s secret: %s, ns: %s", name, namespace)
 			return nil
 		}
 		log.Error(err, "error while retrieving K8s secret: %s, ns: %s", name, namespace)
 		return err
 	}
-	secret.Data = datamap
-	if err := c.Update(ctx, secret); err != nil {
+	if !isManagedSecret(current) {
+		return &foreignSecretError{name: name, namespace: namespace}
+	}
+	updated := current.DeepCopy()
+	if updated.Labels == nil {
+		updated.Labels = make(map[string]string)
+	}
+	for k, v := range secret.Labels {
+		updated.Labels[k] = v
+	}
+	if updated.Annotations == nil {
+		updated.Annotations = make(map[string]string)
+	}
+	for k, v := range secret.Annotations {
+		updated.Annotations[k] = v
+	}
+	updated.OwnerReferences = withPodOwners(updated.OwnerReferences, owners)
+	updated.Data = secret.Data
+	if reflect.DeepEqual(current, updated) {
+		log.Debugf("k8s secret: %s, ns: %s is up to date", name, namespace)
+		return nil
+	}
+	if err := c.Update(ctx, updated); err != nil {
 		log.Error(err, "error while updating K8s secret: %s, ns: %s", name, namespace)
 		return err
 	}
 
-	log.Infof("created k8s secret: %s, ns: %s", name, namespace)
+	log.Infof("updated k8s secret: %s, ns: %s", name, namespace)
 	return nil
 }
 
-// deleteK8sSecret deletes a secret by name
-func deleteK8sSecret(ctx context.Context, name string, namespace string) error {
-	// recreating client here to prevent reading from cache
-	c, err := getClient()
-	if err != nil {
-		return err
+// withPodOwners adds the pod owner references missing from the owner
+// references of a secret. If owners is empty, the pod owner references are
+// removed.
+func withPodOwners(ownerReferences []metav1.OwnerReference, owners []metav1.OwnerReference) []metav1.OwnerReference {
+	var refs []metav1.OwnerReference
+	for _, ref := range ownerReferences {
+		if ref.APIVersion == "v1" && ref.Kind == "Pod" && len(owners) == 0 {
+			continue
+		}
+		refs = append(refs, ref)
 	}
-
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: namespace,
-			Name:      name,
-		},
+	for _, owner := range owners {
+		if !hasOwner(refs, owner.UID) {
+			refs = append(refs, owner)
+		}
 	}
+	return refs
+}
 
-	if err := c.Delete(ctx, secret); err != nil {
-		if errors.IsNotFound(err) {
-			log.Infof("k8s secret not found during delete. Skip. secret: %s, ns: %s", name, namespace)
-			return nil
+// hasOwner returns true if the owner references contain the owner
+func hasOwner(ownerReferences []metav1.OwnerReference, uid types.UID) bool {
+	for _, ref := range ownerReferences {
+		if ref.UID == uid {
+			return true
 		}
-		log.Error(err, "error while deleting K8s secret: %s, ns: %s", name, namespace)
-		return err
 	}
+	return false
+}
 
-	log.Infof("deleted k8s secret: %s, ns: %s", name, namespace)
-	return nil
+// isManagedSecret returns true if the K8s secret is managed by the driver or
+// annotated to be adopted by the driver
+func isManagedSecret(secret *corev1.Secret) bool {
+	return secret.Labels[spcv1alpha1.ManagedLabel] == "true" || secret.Annotations[spcv1alpha1.AdoptAnnotation] == "true"
 }
 
-// setStatus adds pod-specific info to byPod status of the secretproviderclass object
-func setStatus(ctx context.Context, obj *unstructured.Unstructured, id string, namespace string) error {
-	log.Infof("setStatus for pod: %s, ns: %s", id, namespace)
-	// recreating client here to prevent reading from cache
-	c, err := getClient()
-	if err != nil {
-		return err
-	}
-	status := map[string]interface{}{
-		"id":        id,
-		"namespace": namespace,
-	}
-	statuses, _, err := unstructured.NestedSlice(obj.Object, "status", "byPod")
-	if err != nil {
-		return err
-	}
+// isRetained returns true if the K8s secret synced from the secret object is
+// kept when no pod uses it
+func isRetained(secretObject spcv1alpha1.SecretObject) bool {
+	return secretObject.DeletionPolicy == spcv1alpha1.DeletionPolicyRetain
+}
 
-	for _, s := range statuses {
-		curStatus, ok := s.(map[string]interface{})
-		if !ok {
-			log.Infof("could not cast status as map[string]interface{} for object: %s", obj.GetName())
-			continue
-		}
-		curID2, ok := curStatus["id"]
-		if !ok {
-			log.Infof("could not get id from status for object: %s", obj.GetName())
-			continue
-		}
-		curID, ok := curID2.(string)
-		if !ok {
-			log.Infof("could not cast id from status as string for object: %s", obj.GetName())
-			continue
-		}
-		// skip if id already exists
-		if id == curID {
+// deleteK8sSecret deletes a secret by name if it's managed by the driver
+func deleteK8sSecret(ctx context.Context, c client.Client, name string, namespace string) error {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			log.Infof("k8s secret not found during delete. Skip. secret: %s, ns: %s", name, namespace)
 			return nil
 		}
-	}
-
-	statuses = append(statuses, status)
-	if err := unstructured.SetNestedSlice(
-		obj.Object, statuses, "status", "byPod"); err != nil {
-		return err
-	}
-	err = c.Update(ctx, obj)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// deleteStatus deletes pod-specific information from byPod status of the secretproviderclass object
-func deleteStatus(ctx context.Context, obj *unstructured.Unstructured, id string) error {
-	// recreating client here to prevent reading from cache
-	c, err := getClient()
-	if err != nil {
-		return err
-	}
-	statuses, exists, err := unstructured.NestedSlice(obj.Object, "status", "byPod")
-	if err != nil {
+		log.Error(err, "error while retrieving K8s secret: %s, ns: %s", name, namespace)
 		return err
 	}
-	if !exists {
+	if !isManagedSecret(secret) {
+		log.Infof("k8s secret not managed by the driver. Skip. secret: %s, ns: %s", name, namespace)
 		return nil
 	}
-	newStatus := make([]interface{}, 0)
 
-	for i, s := range statuses {
-		curStatus, ok := s.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("element %d in byPod status is malformed for object: %s", i, obj.GetName())
-		}
-		curID2, ok := curStatus["id"]
-		if !ok {
-			return fmt.Errorf("element %d in byPod status is missing an `id` field for object: %s", i, obj.GetName())
-		}
-		curID, ok := curID2.(string)
-		if !ok {
-			return fmt.Errorf("element %d in byPod status' `id` field is not a string: %v for object: %s", i, curID2, obj.GetName())
-		}
-		if id == curID {
-			continue
+	if err := c.Delete(ctx, secret); err != nil {
+		if errors.IsNotFound(err) {
+			log.Infof("k8s secret not found during delete. Skip. secret: %s, ns: %s", name, namespace)
+			return nil
 		}
-		newStatus = append(newStatus, s)
-	}
-
-	if len(newStatus) == len(statuses) {
-		log.Infof("could not find pod %s in status for object: %s. Skip updating object", id, obj.GetName())
-		return nil
-	}
-	if err := unstructured.SetNestedSlice(obj.Object, newStatus, "status", "byPod"); err != nil {
-		return err
-	}
-	err = c.Update(ctx, obj)
-	if err != nil {
+		log.Error(err, "error while deleting K8s secret: %s, ns: %s", name, namespace)
 		return err
 	}
+
+	log.Infof("deleted k8s secret: %s, ns: %s", name, namespace)
 	return nil
 }
 
-// getNamespaceByPodID returns namespace of the pod with podUID from the status of the secretproviderclass object
-func getNamespaceByPodID(obj *unstructured.Unstructured, id string) (string, error) {
-	statuses, exists, err := unstructured.NestedSlice(obj.Object, "status", "byPod")
-	if err != nil {
-		return "", err
-	}
-	if !exists {
-		return "", nil
+// getSecretProviderClass returns the secretproviderclass object by name from
+// the namespace
+func getSecretProviderClass(ctx context.Context, c client.Reader, name, namespace string) (*spcv1alpha1.SecretProviderClass, error) {
+	if len(namespace) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "namespace of secretproviderclass %s is not set", name)
 	}
-
-	for i, s := range statuses {
-		curStatus, ok := s.(map[string]interface{})
-		if !ok {
-			return "", fmt.Errorf("element %d in byPod status is malformed for pod: %s", i, id)
-		}
-		curID2, ok := curStatus["id"]
-		if !ok {
-			return "", fmt.Errorf("element %d in byPod status is missing an `id` field for pod: %s", i, id)
-		}
-		curID, ok := curID2.(string)
-		if !ok {
-			return "", fmt.Errorf("element %d in byPod status' `id` field is not a string: %v for pod: %s", i, curID2, id)
-		}
-		if id == curID {
-			namespace2, ok := curStatus["namespace"]
-			if !ok {
-				return "", fmt.Errorf("element %d in byPod status is missing an `namespace` field for pod: %s", i, id)
-			}
-			namespace, ok := namespace2.(string)
-			if !ok {
-				return "", fmt.Errorf("element %d in byPod status' `namespace` field is not a string: %v for pod: %s", i, namespace2, id)
-			}
-			return namespace, nil
-		}
+	spc := &spcv1alpha1.SecretProviderClass{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, spc); err != nil {
+		return nil, err
 	}
-
-	return "", fmt.Errorf("could not find pod id %s in status", id)
+	return spc, nil
 }
 
-// getClient returns client.Client
-func getClient() (client.Client, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return nil, err
+// lookupSecretProviderClass returns the secretproviderclass object referenced
+// by a pod volume. The object is looked up in the pod namespace. If the
+// object doesn't exist in the pod namespace and sharedNamespace is set, the
+// object is looked up in sharedNamespace, which contains the objects shared
+// by all namespaces.
+func lookupSecretProviderClass(ctx context.Context, c client.Reader, name, podNamespace, sharedNamespace string) (*spcv1alpha1.SecretProviderClass, error) {
+	spc, err := getSecretProviderClass(ctx, c, name, podNamespace)
+	if err == nil {
+		return spc, nil
+	}
+	if !errors.IsNotFound(err) || len(sharedNamespace) == 0 || sharedNamespace == podNamespace {
+		return nil, status.Errorf(secretProviderClassErrorCode(err), "failed to get secretproviderclass %s/%s, err: %v", podNamespace, name, err)
 	}
-	c, err := client.New(cfg, client.Options{Scheme: nil, Mapper: nil})
+	spc, err = getSecretProviderClass(ctx, c, name, sharedNamespace)
 	if err != nil {
-		return nil, err
+		return nil, status.Errorf(secretProviderClassErrorCode(err), "failed to get secretproviderclass %s in namespace %s or shared namespace %s, err: %v", name, podNamespace, sharedNamespace, err)
 	}
-	return c, nil
+	log.Debugf("using secretproviderclass %s from shared namespace %s for ns: %s", name, sharedNamespace, podNamespace)
+	return spc, nil
 }
 
-// getStatusCount returns the total number of objects in the byPod status field of the secretproviderclass object
-func getStatusCount(obj *unstructured.Unstructured) (int, error) {
-	statuses, exists, err := unstructured.NestedSlice(obj.Object, "status", "byPod")
-	if err != nil {
-		return 0, err
+// secretProviderClassErrorCode returns the code of an error getting a
+// secretproviderclass. Errors other than the object not being found are
+// reported as Unavailable as the API server may not be reachable.
+func secretProviderClassErrorCode(err error) codes.Code {
+	if errors.IsNotFound(err) {
+		return codes.NotFound
 	}
-	if err == nil && exists {
-		return len(statuses), nil
+	if code := status.Code(err); code != codes.Unknown {
+		return code
 	}
-	return 0, nil
+	return codes.Unavailable
 }
 
-// getSecretProviderItemByName returns the secretproviderclass object by name
-func getSecretProviderItemByName(ctx context.Context, name string) (*unstructured.Unstructured, error) {
-	instanceList := &unstructured.UnstructuredList{}
-	instanceList.SetGroupVersionKind(secretProviderClassGvk)
-	// recreating client here to prevent reading from cache
-	c, err := getClient()
-	if err != nil {
-		return nil, err
-	}
-	err = c.List(ctx, instanceList)
-	if err != nil {
-		return nil, err
+// getSecretNames returns the names of the K8s secrets synced from the
+// secret objects that are deleted when no pod uses them
+func getSecretNames(secretObjects []spcv1alpha1.SecretObject) []string {
+	var secretNames []string
+	for _, secretObject := range secretObjects {
+		if isRetained(secretObject) {
+			continue
+		}
+		secretNames = append(secretNames, secretObject.SecretName)
 	}
+	return secretNames
+}
 
-	for _, item := range instanceList.Items {
-		if item.GetName() == name {
-			return &item, nil
-		}
+// getParameters returns a copy of the provider parameters of the
+// secretproviderclass object that the pod information can be added to
+func getParameters(obj *spcv1alpha1.SecretProviderClass) map[string]string {
+	parameters := make(map[string]string, len(obj.Spec.Parameters))
+	for k, v := range obj.Spec.Parameters {
+		parameters[k] = v
 	}
-	return nil, fmt.Errorf("could not find secretproviderclass %s", name)
+	return parameters
 }
 
-// getItemWithPodID returns the secretproviderclass object with podUID
-func getItemWithPodID(ctx context.Context, podUID string) (*unstructured.Unstructured, string, error) {
-	// recreating client here to prevent reading from cache
-	c, err := getClient()
-	if err != nil {
-		return nil, "", err
+// validateSecretProviderClass validates the fields of the secretproviderclass
+// object used by the driver. Objects created before the CRD validated the
+// schema can have missing fields, e.g. due to a typo in the field name.
+func validateSecretProviderClass(obj *spcv1alpha1.SecretProviderClass) error {
+	if len(obj.Spec.Provider) == 0 {
+		return fmt.Errorf("field provider is not set in secretproviderclass %s", obj.GetName())
 	}
-	instanceList := &unstructured.UnstructuredList{}
-	instanceList.SetGroupVersionKind(secretProviderClassGvk)
-	err = c.List(ctx, instanceList)
-	if err != nil {
-		return nil, "", err
+	if len(obj.Spec.Parameters) == 0 {
+		return fmt.Errorf("field parameters is not set in secretproviderclass %s", obj.GetName())
 	}
-
-	for _, item := range instanceList.Items {
-		podNS, err := getNamespaceByPodID(&item, podUID)
-		if err != nil || len(podNS) == 0 {
-			continue
+	for i, secretObject := range obj.Spec.SecretObjects {
+		if len(secretObject.SecretName) == 0 {
+			return fmt.Errorf("field secretName is not set in secretObjects[%d] of secretproviderclass %s", i, obj.GetName())
 		}
-		if err == nil && len(podNS) > 0 {
-			return &item, podNS, nil
+		if len(secretObject.Type) == 0 {
+			return fmt.Errorf("field type is not set in secretObjects[%d] of secretproviderclass %s", i, obj.GetName())
+		}
+		if len(secretObject.Data) == 0 {
+			return fmt.Errorf("field data is not set in secretObjects[%d] of secretproviderclass %s", i, obj.GetName())
+		}
+		for j, data := range secretObject.Data {
+			if len(data.ObjectName) == 0 {
+				return fmt.Errorf("field objectName is not set in secretObjects[%d].data[%d] of secretproviderclass %s", i, j, obj.GetName())
+			}
+			if len(data.Key) == 0 {
+				return fmt.Errorf("field key is not set in secretObjects[%d].data[%d] of secretproviderclass %s", i, j, obj.GetName())
+			}
+			if len(data.JSONPath) > 0 {
+				if _, err := parseJSONPath(data.JSONPath); err != nil {
+					return fmt.Errorf("field jsonPath is invalid in secretObjects[%d].data[%d] of secretproviderclass %s, err: %v", i, j, obj.GetName(), err)
+				}
+			}
+			switch data.Decode {
+			case "", spcv1alpha1.DecodingBase64, spcv1alpha1.DecodingHex:
+			default:
+				return fmt.Errorf("field decode must be %s or %s in secretObjects[%d].data[%d] of secretproviderclass %s, got %s", spcv1alpha1.DecodingBase64, spcv1alpha1.DecodingHex, i, j, obj.GetName(), data.Decode)
+			}
 		}
 	}
-	return nil, "", nil
-}
-
-// getSecretObjectsFromSpec returns secretObjects if it exists in the spec
-func getSecretObjectsFromSpec(item *unstructured.Unstructured) ([]interface{}, bool, error) {
-	secretObjects, exists, err := unstructured.NestedSlice(item.Object, "spec", secretObjectsField)
-	if err != nil {
-		return nil, false, err
-	}
-	return secretObjects, exists && len(secretObjects) > 0, nil
+	return nil
 }
 
 // getSecretType returns a k8s secret type, defaults to Opaque
@@ -676,132 +676,316 @@ func getSecretType(sType string) corev1.SecretType {
 	}
 }
 
-func getStringFromObjectSpec(object map[string]interface{}, key string) (string, error) {
-	value, exists, err := unstructured.NestedString(object, "spec", key)
-	if err != nil {
-		return "", err
-	}
-	if !exists {
-		return "", fmt.Errorf("could not get field %s from spec", key)
-	}
-	if len(value) == 0 {
-		return "", fmt.Errorf("field %s is not set", key)
+// getSecretObjectData returns the value of the data field of a K8s secret
+// from the content of the mounted object. If set, the field of the JSON or
+// YAML object is selected with the jsonPath and the value is decoded.
+func getSecretObjectData(data []byte, secretObjectData spcv1alpha1.SecretObjectData) ([]byte, error) {
+	if len(secretObjectData.JSONPath) > 0 {
+		var err error
+		if data, err = getField(data, secretObjectData.JSONPath); err != nil {
+			return nil, err
+		}
 	}
-	return value, nil
+	return decode(data, secretObjectData.Decode)
 }
 
-func getStringFromObject(object map[string]interface{}, key string) (string, error) {
-	value, exists, err := unstructured.NestedString(object, key)
-	if err != nil {
-		return "", err
+// parseJSONPath parses the jsonPath, the braces of the template are optional
+func parseJSONPath(path string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
 	}
-	if !exists {
-		return "", fmt.Errorf("could not get field %s from spec", key)
-	}
-	if len(value) == 0 {
-		return "", fmt.Errorf("field %s is not set", key)
+	j := jsonpath.New("jsonPath")
+	if err := j.Parse(path); err != nil {
+		return nil, err
 	}
-	return value, nil
+	return j, nil
 }
 
-func getMapFromObjectSpec(object map[string]interface{}, key string) (map[string]string, error) {
-	value, exists, err := unstructured.NestedStringMap(object, "spec", key)
+// getField returns the field of the JSON or YAML object selected with the
+// jsonPath. String fields are returned as is, other fields are JSON encoded.
+func getField(data []byte, path string) ([]byte, error) {
+	j, err := parseJSONPath(path)
 	if err != nil {
 		return nil, err
 	}
-	if !exists {
-		return nil, fmt.Errorf("could not get field %s from spec", key)
+	// JSON objects are valid YAML objects
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("object is not a JSON or YAML object, err: %v", err)
 	}
-	if len(value) == 0 {
-		return nil, fmt.Errorf("field %s is not set", key)
+	var obj interface{}
+	if err := json.Unmarshal(jsonData, &obj); err != nil {
+		return nil, fmt.Errorf("object is not a JSON or YAML object, err: %v", err)
 	}
-	return value, nil
-}
-
-func getSliceFromObject(object map[string]interface{}, key string) ([]interface{}, error) {
-	value, exists, err := unstructured.NestedSlice(object, key)
+	results, err := j.FindResults(obj)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to find jsonPath %s, err: %v", path, err)
 	}
-	if !exists {
-		return nil, fmt.Errorf("could not get field %s from spec", key)
+	var values []interface{}
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, value.Interface())
+		}
 	}
-	if len(value) == 0 {
-		return nil, fmt.Errorf("field %s is not set", key)
+	if len(values) != 1 {
+		return nil, fmt.Errorf("jsonPath %s must select a single field, got %d", path, len(values))
 	}
-	return value, nil
+	if value, ok := values[0].(string); ok {
+		return []byte(value), nil
+	}
+	return json.Marshal(values[0])
 }
 
-// getCertPart returns the certificate or the private key part of the cert
+// decode decodes the value with the decoding, the value is returned as is if
+// the decoding isn't set
+func decode(data []byte, decoding spcv1alpha1.Decoding) ([]byte, error) {
+	switch decoding {
+	case "":
+		return data, nil
+	case spcv1alpha1.DecodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 value, err: %v", err)
+		}
+		return decoded, nil
+	case spcv1alpha1.DecodingHex:
+		decoded, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode hex value, err: %v", err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("decoding %s is not supported. Only %s and %s are supported", decoding, spcv1alpha1.DecodingBase64, spcv1alpha1.DecodingHex)
+}
+
+// getCertPart returns the certificate chain, the issuing chain or the private
+// key part of a cert. The certificates and the private key must parse and the
+// private key must match the leaf certificate if the cert contains both.
 func getCertPart(data []byte, key string) ([]byte, error) {
-	if key == corev1.TLSPrivateKeyKey {
+	switch key {
+	case corev1.TLSPrivateKeyKey:
 		return getPrivateKey(data)
+	case corev1.TLSCertKey:
+		chain, err := getCertChain(data)
+		if err != nil {
+			return nil, err
+		}
+		return encodeCerts(chain), nil
+	case caCertKey:
+		chain, err := getCertChain(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(chain) < 2 {
+			return nil, fmt.Errorf("no issuing certificate found for %s", caCertKey)
+		}
+		return encodeCerts(chain[1:]), nil
+	}
+	return nil, fmt.Errorf("tls key is not supported. Only tls.key, tls.crt and ca.crt are supported")
+}
+
+// validateKeyPair validates the private key of a K8s TLS secret matches its
+// leaf certificate
+func validateKeyPair(datamap map[string][]byte) error {
+	certPEM, hasCert := datamap[corev1.TLSCertKey]
+	keyPEM, hasKey := datamap[corev1.TLSPrivateKeyKey]
+	if !hasCert || !hasKey {
+		return nil
 	}
-	if key == corev1.TLSCertKey {
-		return getCert(data)
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("tls.key does not match tls.crt, err: %v", err)
 	}
-	return nil, fmt.Errorf("tls key is not supported. Only tls.key and tls.crt are supported")
+	return nil
 }
 
-// getCert returns the certificate part of a cert
-func getCert(data []byte) ([]byte, error) {
-	var certs []byte
-	for {
-		pemBlock, rest := pem.Decode(data)
-		if pemBlock == nil {
+// getCertChain returns the certificates of a cert ordered from the leaf
+// certificate to the root. The leaf certificate is the certificate of the
+// private key if the cert contains one, or the only certificate that doesn't
+// issue another certificate of the cert. All certificates must be part of
+// the chain.
+func getCertChain(data []byte) ([]*x509.Certificate, error) {
+	certs, key, err := parseCert(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+
+	var leaf *x509.Certificate
+	if key != nil {
+		for _, cert := range certs {
+			if publicKeyMatches(cert.PublicKey, key) {
+				leaf = cert
+				break
+			}
+		}
+		if leaf == nil {
+			return nil, fmt.Errorf("private key does not match any certificate")
+		}
+	} else {
+		var leaves []*x509.Certificate
+		for _, cert := range certs {
+			if !issuesAny(cert, certs) {
+				leaves = append(leaves, cert)
+			}
+		}
+		if len(leaves) != 1 {
+			return nil, fmt.Errorf("found %d leaf certificates, expected a single certificate chain", len(leaves))
+		}
+		leaf = leaves[0]
+	}
+
+	chain := []*x509.Certificate{leaf}
+	for current := leaf; ; {
+		issuer := findIssuer(current, certs, chain)
+		if issuer == nil {
 			break
 		}
-		if pemBlock.Type == certType {
-			block := pem.EncodeToMemory(pemBlock)
-			certs = append(certs, block...)
+		chain = append(chain, issuer)
+		current = issuer
+	}
+	if len(chain) != len(certs) {
+		for _, cert := range certs {
+			if !containsCert(chain, cert) {
+				return nil, fmt.Errorf("certificate %q is not part of the chain of %q", cert.Subject, leaf.Subject)
+			}
 		}
-		data = rest
 	}
-	return certs, nil
+	return chain, nil
 }
 
-// getPrivateKey returns the private key part of a cert
-func getPrivateKey(data []byte) ([]byte, error) {
-	var der []byte
-	var derKey []byte
+// parseCert parses the certificates and the private key, if any, of a cert
+func parseCert(data []byte) ([]*x509.Certificate, crypto.Signer, error) {
+	var certs []*x509.Certificate
+	var key crypto.Signer
 	for {
 		pemBlock, rest := pem.Decode(data)
 		if pemBlock == nil {
 			break
 		}
-		if pemBlock.Type != certType {
-			der = pemBlock.Bytes
-		}
 		data = rest
+		switch pemBlock.Type {
+		case certType:
+			cert, err := x509.ParseCertificate(pemBlock.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse certificate, err: %v", err)
+			}
+			certs = append(certs, cert)
+		case ecParametersType:
+			// the curve is part of the EC private key
+		default:
+			if key != nil {
+				return nil, nil, fmt.Errorf("found more than one private key")
+			}
+			var err error
+			if key, err = parsePrivateKey(pemBlock); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
+	return certs, key, nil
+}
 
-	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
-		derKey = x509.MarshalPKCS1PrivateKey(key)
+// parsePrivateKey parses a PKCS #1, PKCS #8 or EC private key
+func parsePrivateKey(pemBlock *pem.Block) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes); err == nil {
+		return key, nil
 	}
-
-	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+	if key, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes); err == nil {
 		switch key := key.(type) {
 		case *rsa.PrivateKey:
-			derKey = x509.MarshalPKCS1PrivateKey(key)
+			return key, nil
 		case *ecdsa.PrivateKey:
-			derKey, err = x509.MarshalECPrivateKey(key)
-			if err != nil {
-				return nil, err
-			}
+			return key, nil
 		default:
 			return nil, fmt.Errorf("unknown private key type found while getting key. Only rsa and ecdsa are supported")
 		}
 	}
-	if key, err := x509.ParseECPrivateKey(der); err == nil {
-		derKey, err = x509.MarshalECPrivateKey(key)
-		if err != nil {
-			return nil, err
+	if key, err := x509.ParseECPrivateKey(pemBlock.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key in %s block", pemBlock.Type)
+}
+
+// publicKeyMatches returns true if the public key is the public key of the
+// private key
+func publicKeyMatches(publicKey interface{}, key crypto.Signer) bool {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		certPub, ok := publicKey.(*rsa.PublicKey)
+		return ok && pub.N.Cmp(certPub.N) == 0 && pub.E == certPub.E
+	case *ecdsa.PublicKey:
+		certPub, ok := publicKey.(*ecdsa.PublicKey)
+		return ok && pub.Curve == certPub.Curve && pub.X.Cmp(certPub.X) == 0 && pub.Y.Cmp(certPub.Y) == 0
+	}
+	return false
+}
+
+// issuesAny returns true if the certificate issues another certificate
+func issuesAny(issuer *x509.Certificate, certs []*x509.Certificate) bool {
+	for _, cert := range certs {
+		if cert != issuer && cert.CheckSignatureFrom(issuer) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// findIssuer returns the certificate issuing cert that isn't in the chain yet
+func findIssuer(cert *x509.Certificate, certs, chain []*x509.Certificate) *x509.Certificate {
+	for _, issuer := range certs {
+		if !containsCert(chain, issuer) && cert.CheckSignatureFrom(issuer) == nil {
+			return issuer
 		}
 	}
-	block := &pem.Block{
-		Type:  privateKeyType,
-		Bytes: derKey,
+	return nil
+}
+
+// containsCert returns true if the certificates contain cert
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c == cert {
+			return true
+		}
 	}
+	return false
+}
 
-	return pem.EncodeToMemory(block), nil
+// encodeCerts returns the PEM encoded certificates
+func encodeCerts(certs []*x509.Certificate) []byte {
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: certType, Bytes: cert.Raw})...)
+	}
+	return data
+}
+
+// getPrivateKey returns the private key part of a cert as a PKCS #1 RSA or
+// EC private key. The private key must match a certificate of the cert.
+func getPrivateKey(data []byte) ([]byte, error) {
+	certs, key, err := parseCert(data)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no private key found")
+	}
+	if len(certs) > 0 {
+		if _, err := getCertChain(data); err != nil {
+			return nil, err
+		}
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: privateKeyType, Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case *ecdsa.PrivateKey:
+		derKey, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: ecPrivateKeyType, Bytes: derKey}), nil
+	}
+	return nil, fmt.Errorf("unknown private key type found while getting key. Only rsa and ecdsa are supported")
 }
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"sync"
+)
+
+const (
+	// volumeOperationAlreadyExistsFmt is the error returned for an operation
+	// on a target path with another operation in flight
+	volumeOperationAlreadyExistsFmt = "an operation with the given target path %s already exists"
+)
+
+// volumeLocks tracks the in-flight operations on the published volumes by
+// target path so overlapping operations can be rejected instead of
+// interleaving
+type volumeLocks struct {
+	lock  sync.Mutex
+	locks map[string]struct{}
+}
+
+func newVolumeLocks() *volumeLocks {
+	return &volumeLocks{
+		locks: make(map[string]struct{}),
+	}
+}
+
+// tryAcquire starts an operation on the target path. It returns false if
+// another operation on the target path is in flight.
+func (l *volumeLocks) tryAcquire(targetPath string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, exists := l.locks[targetPath]; exists {
+		return false
+	}
+	l.locks[targetPath] = struct{}{}
+	return true
+}
+
+// release ends the operation on the target path
+func (l *volumeLocks) release(targetPath string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.locks, targetPath)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/utils/mount"
+)
+
+func TestVolumeLocks(t *testing.T) {
+	locks := newVolumeLocks()
+
+	assert.True(t, locks.tryAcquire("/target1"))
+	assert.False(t, locks.tryAcquire("/target1"))
+	// operations on other target paths are not blocked
+	assert.True(t, locks.tryAcquire("/target2"))
+
+	locks.release("/target1")
+	assert.True(t, locks.tryAcquire("/target1"))
+}
+
+func TestConcurrentVolumeOperations(t *testing.T) {
+	providerDir, err := ioutil.TempDir("", "providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(providerDir)
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	provider := &fakeProviderServer{mounting: make(chan struct{}), unblock: make(chan struct{})}
+	server := newFakeProviderServer(t, filepath.Join(providerDir, "fakeprovider.sock"), provider)
+	defer server.Stop()
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid", ProviderVolumePath: providerDir}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.providerClients.Cleanup()
+	ns.mounter = &mount.FakeMounter{}
+
+	publishReq := &csi.NodePublishVolumeRequest{
+		VolumeId:   "vol1",
+		TargetPath: targetPath,
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		},
+		Readonly: true,
+		VolumeContext: map[string]string{
+			"providerName":  "fakeprovider",
+			csipodname:      "pod1",
+			csipodnamespace: "default",
+			csipoduid:       "pod1",
+		},
+	}
+	unpublishReq := &csi.NodeUnpublishVolumeRequest{VolumeId: "vol1", TargetPath: targetPath}
+
+	published := make(chan error)
+	go func() {
+		_, err := ns.NodePublishVolume(context.Background(), publishReq)
+		published <- err
+	}()
+	// wait for the publish to be in flight in the provider
+	<-provider.mounting
+
+	_, err = ns.NodePublishVolume(context.Background(), publishReq)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	_, err = ns.NodeUnpublishVolume(context.Background(), unpublishReq)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	// the volume is only unmounted once the publish completes
+	assert.Len(t, ns.mounter.(*mount.FakeMounter).MountPoints, 1)
+
+	close(provider.unblock)
+	assert.NoError(t, <-published)
+	_, ok := ns.volumes.get(targetPath)
+	assert.True(t, ok)
+
+	// the fake mounter doesn't discard the content of the tmpfs on unmount
+	files, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		os.RemoveAll(filepath.Join(targetPath, file.Name()))
+	}
+	_, err = ns.NodeUnpublishVolume(context.Background(), unpublishReq)
+	assert.NoError(t, err)
+	assert.Empty(t, ns.mounter.(*mount.FakeMounter).MountPoints)
+	_, ok = ns.volumes.get(targetPath)
+	assert.False(t, ok)
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// stateFileSuffix is the suffix of the files the published volumes are
+	// persisted to in the state dir
+	stateFileSuffix = ".json"
+	// stateFileMode restricts the state files to the driver as they contain
+	// the provider parameters
+	stateFileMode os.FileMode = 0600
+)
+
+// publishedVolume is a secrets store volume published to a pod on the node
+type publishedVolume struct {
+	VolumeID            string `json:"volumeID"`
+	TargetPath          string `json:"targetPath"`
+	PodName             string `json:"podName"`
+	PodNamespace        string `json:"podNamespace"`
+	PodUID              string `json:"podUID"`
+	SecretProviderClass string `json:"secretProviderClass,omitempty"`
+	// SecretProviderClassNamespace is the pod namespace or the shared
+	// namespace the secretproviderclass was found in
+	SecretProviderClassNamespace string `json:"secretProviderClassNamespace,omitempty"`
+	// ProviderName is the provider the volume was last mounted with
+	ProviderName string `json:"providerName"`
+	// Parameters are only set for volumes that don't reference a
+	// SecretProviderClass
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Secrets is the content of the nodePublishSecretRef. It's never
+	// persisted, so it's lost when the driver restarts.
+	Secrets map[string]string `json:"-"`
+	// HasSecrets is set if the volume was published with a
+	// nodePublishSecretRef
+	HasSecrets bool `json:"hasSecrets,omitempty"`
+	// ServiceAccountName is the name of the pod service account
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// ServiceAccountTokens are the service account tokens the volume was
+	// last published with. Like Secrets, they're never persisted.
+	ServiceAccountTokens string `json:"-"`
+	// HasServiceAccountTokens is set if the volume was published with
+	// service account tokens
+	HasServiceAccountTokens bool `json:"hasServiceAccountTokens,omitempty"`
+	// SecretNames are the names of the K8s secrets synced from the volume
+	SecretNames []string `json:"secretNames,omitempty"`
+	// ObjectVersions are the versions of the currently mounted objects
+	ObjectVersions map[string]string `json:"objectVersions,omitempty"`
+	// ContentSecretName and ContentSecretVersion are the name and resource
+	// version of the secret the mounted content of the synced objects was
+	// last written to in controller mode, at ContentSecretUpdateTime
+	ContentSecretName       string       `json:"contentSecretName,omitempty"`
+	ContentSecretVersion    string       `json:"contentSecretVersion,omitempty"`
+	ContentSecretUpdateTime *metav1.Time `json:"contentSecretUpdateTime,omitempty"`
+	// Files are the paths of the currently mounted files relative to the
+	// target path
+	Files []string `json:"files,omitempty"`
+	// RotationError is the error of the last rotation, if it failed
+	RotationError string `json:"-"`
+}
+
+// publishedVolumes tracks the volumes published on the node by target path.
+// If dir is set, every volume is also persisted to a JSON file in dir so the
+// volumes can be recovered when the driver restarts.
+type publishedVolumes struct {
+	lock    sync.RWMutex
+	volumes map[string]publishedVolume
+	dir     string
+}
+
+func newPublishedVolumes() *publishedVolumes {
+	return &publishedVolumes{
+		volumes: make(map[string]publishedVolume),
+	}
+}
+
+// loadPublishedVolumes returns the volumes persisted in the state dir. The
+// state dir is created if it doesn't exist. Files that can't be decoded are
+// skipped.
+func loadPublishedVolumes(dir string) (*publishedVolumes, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state dir %s, err: %v", dir, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state dir %s, err: %v", dir, err)
+	}
+	p := newPublishedVolumes()
+	p.dir = dir
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), stateFileSuffix) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.Errorf("failed to read state file %s, err: %v", file.Name(), err)
+			continue
+		}
+		var vol publishedVolume
+		if err := json.Unmarshal(data, &vol); err != nil || len(vol.TargetPath) == 0 {
+			log.Errorf("failed to decode state file %s, err: %v", file.Name(), err)
+			continue
+		}
+		p.volumes[vol.TargetPath] = vol
+	}
+	log.Infof("loaded %d published volumes from state dir %s", len(p.volumes), dir)
+	return p, nil
+}
+
+// add adds or replaces the volume published at the volume's target path
+func (p *publishedVolumes) add(vol publishedVolume) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.volumes[vol.TargetPath] = vol
+	p.persist(vol)
+}
+
+// remove removes the volume published at the target path
+func (p *publishedVolumes) remove(targetPath string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	vol, ok := p.volumes[targetPath]
+	if !ok {
+		return
+	}
+	delete(p.volumes, targetPath)
+	if len(p.dir) == 0 {
+		return
+	}
+	if err := os.Remove(p.stateFile(targetPath)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("failed to remove state of volume %s, err: %v", vol.VolumeID, err)
+	}
+}
+
+// get returns the volume published at the target path
+func (p *publishedVolumes) get(targetPath string) (publishedVolume, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	vol, ok := p.volumes[targetPath]
+	return vol, ok
+}
+
+// list returns all the published volumes
+func (p *publishedVolumes) list() []publishedVolume {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	vols := make([]publishedVolume, 0, len(p.volumes))
+	for _, vol := range p.volumes {
+		vols = append(vols, vol)
+	}
+	return vols
+}
+
+// setObjectVersions updates the object versions of the volume published at
+// the target path. It's a no-op if the volume has been removed.
+func (p *publishedVolumes) setObjectVersions(targetPath string, objectVersions map[string]string) {
+	p.update(targetPath, true, func(vol *publishedVolume) {
+		vol.ObjectVersions = objectVersions
+	})
+}
+
+// setFiles updates the mounted files of the volume published at the target
+// path. It's a no-op if the volume has been removed.
+func (p *publishedVolumes) setFiles(targetPath string, files []string) {
+	p.update(targetPath, true, func(vol *publishedVolume) {
+		vol.Files = files
+	})
+}
+
+// setSecretNames updates the names of the K8s secrets synced from the volume
+// published at the target path. It's a no-op if the volume has been removed.
+func (p *publishedVolumes) setSecretNames(targetPath string, secretNames []string) {
+	p.update(targetPath, true, func(vol *publishedVolume) {
+		vol.SecretNames = secretNames
+	})
+}
+
+// setContentSecret updates the content secret of the volume published at the
+// target path. It's a no-op if the volume has been removed.
+func (p *publishedVolumes) setContentSecret(targetPath, name, version string, updateTime *metav1.Time) {
+	p.update(targetPath, true, func(vol *publishedVolume) {
+		vol.ContentSecretName = name
+		vol.ContentSecretVersion = version
+		vol.ContentSecretUpdateTime = updateTime
+	})
+}
+
+// setServiceAccountTokens updates the service account tokens of the volume
+// published at the target path. The tokens aren't persisted. It's a no-op if
+// the volume has been removed.
+func (p *publishedVolumes) setServiceAccountTokens(targetPath, tokens string) {
+	p.update(targetPath, false, func(vol *publishedVolume) {
+		vol.ServiceAccountTokens = tokens
+	})
+}
+
+// setRotationError records the result of the last rotation of the volume
+// published at the target path. It's a no-op if the volume has been removed.
+func (p *publishedVolumes) setRotationError(targetPath string, err error) {
+	p.update(targetPath, false, func(vol *publishedVolume) {
+		vol.RotationError = ""
+		if err != nil {
+			vol.RotationError = err.Error()
+		}
+	})
+}
+
+// update applies fn to the volume published at the target path and persists
+// the volume if requested
+func (p *publishedVolumes) update(targetPath string, persist bool, fn func(vol *publishedVolume)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	vol, ok := p.volumes[targetPath]
+	if !ok {
+		return
+	}
+	fn(&vol)
+	p.volumes[targetPath] = vol
+	if persist {
+		p.persist(vol)
+	}
+}
+
+// persist writes the volume to its state file. Failures are only logged as
+// the volume is still tracked in memory until the driver restarts.
+func (p *publishedVolumes) persist(vol publishedVolume) {
+	if len(p.dir) == 0 {
+		return
+	}
+	if err := p.writeStateFile(vol); err != nil {
+		log.Errorf("failed to persist state of volume %s, err: %v", vol.VolumeID, err)
+	}
+}
+
+// writeStateFile atomically replaces the state file of the volume
+func (p *publishedVolumes) writeStateFile(vol publishedVolume) error {
+	data, err := json.Marshal(vol)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(p.dir, ".tmp_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(stateFileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.stateFile(vol.TargetPath))
+}
+
+// stateFile returns the path of the state file of the volume published at the
+// target path. The volumes are tracked by target path as a volume can be
+// published at several target paths, the file is named by a hash of the
+// target path so it's a valid file name.
+func (p *publishedVolumes) stateFile(targetPath string) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%x", sha256.Sum256([]byte(targetPath)))+stateFileSuffix)
+}
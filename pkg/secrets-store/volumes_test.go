@@ -0,0 +1,163 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	spcv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/secretProviderClass/api/v1alpha1"
+)
+
+func TestPublishedVolumes(t *testing.T) {
+	volumes := newPublishedVolumes()
+	volumes.add(publishedVolume{TargetPath: "/target1", PodUID: "pod1"})
+	volumes.add(publishedVolume{TargetPath: "/target2", PodUID: "pod2"})
+	assert.Len(t, volumes.list(), 2)
+
+	volumes.setObjectVersions("/target1", map[string]string{"object1": "v2"})
+	vol, ok := volumes.get("/target1")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"object1": "v2"}, vol.ObjectVersions)
+
+	volumes.remove("/target1")
+	_, ok = volumes.get("/target1")
+	assert.False(t, ok)
+	// updating a removed volume must not add it back
+	volumes.setObjectVersions("/target1", map[string]string{"object1": "v3"})
+	_, ok = volumes.get("/target1")
+	assert.False(t, ok)
+	assert.Len(t, volumes.list(), 1)
+}
+
+func TestLoadPublishedVolumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateDir := filepath.Join(dir, "volumes")
+
+	volumes, err := loadPublishedVolumes(stateDir)
+	assert.NoError(t, err)
+	assert.Len(t, volumes.list(), 0)
+
+	volumes.add(publishedVolume{
+		VolumeID:            "csi-volume1",
+		TargetPath:          "/target1",
+		PodUID:              "pod1",
+		PodNamespace:        "default",
+		SecretProviderClass: "spc1",
+		ProviderName:        "provider1",
+		Secrets:             map[string]string{"clientid": "secret"},
+		HasSecrets:          true,
+		SecretNames:         []string{"secret1"},
+	})
+	volumes.add(publishedVolume{VolumeID: "csi/volume2", TargetPath: "/target2", PodUID: "pod2"})
+	volumes.setObjectVersions("/target1", map[string]string{"object1": "v1"})
+	volumes.remove("/target2")
+	// invalid state files are skipped
+	if err := ioutil.WriteFile(filepath.Join(stateDir, "invalid.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(volumes.stateFile("/target1"))
+	assert.NoError(t, err)
+	// the nodePublishSecretRef must never be written to disk
+	assert.NotContains(t, string(data), "clientid")
+
+	restored, err := loadPublishedVolumes(stateDir)
+	assert.NoError(t, err)
+	assert.Len(t, restored.list(), 1)
+	vol, ok := restored.get("/target1")
+	assert.True(t, ok)
+	assert.Equal(t, "pod1", vol.PodUID)
+	assert.Equal(t, "spc1", vol.SecretProviderClass)
+	assert.Equal(t, "provider1", vol.ProviderName)
+	assert.Nil(t, vol.Secrets)
+	assert.True(t, vol.HasSecrets)
+	assert.Equal(t, []string{"secret1"}, vol.SecretNames)
+	assert.Equal(t, map[string]string{"object1": "v1"}, vol.ObjectVersions)
+}
+
+func TestPublishedVolumesSameVolumeID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	volumes, err := loadPublishedVolumes(dir)
+	assert.NoError(t, err)
+	// the volume is published at two target paths
+	volumes.add(publishedVolume{VolumeID: "csi-volume1", TargetPath: "/target1", PodUID: "pod1"})
+	volumes.add(publishedVolume{VolumeID: "csi-volume1", TargetPath: "/target2", PodUID: "pod1"})
+
+	restored, err := loadPublishedVolumes(dir)
+	assert.NoError(t, err)
+	assert.Len(t, restored.list(), 2)
+
+	// removing one target path keeps the state of the other
+	volumes.remove("/target1")
+	restored, err = loadPublishedVolumes(dir)
+	assert.NoError(t, err)
+	assert.Len(t, restored.list(), 1)
+	_, ok := restored.get("/target2")
+	assert.True(t, ok)
+}
+
+func TestGetPublishedK8sObjects(t *testing.T) {
+	ctx := context.Background()
+	ns := &nodeServer{
+		nodeID:  "node1",
+		volumes: newPublishedVolumes(),
+		client: fake.NewFakeClientWithScheme(scheme,
+			newPodStatus(publishedVolume{TargetPath: "/untracked", PodName: "pod2", PodNamespace: "ns1", PodUID: "uid2", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns1"}, "node1"),
+		),
+		reader: fake.NewFakeClientWithScheme(scheme, &spcv1alpha1.SecretProviderClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "spc1", Namespace: "ns1"},
+			Spec: spcv1alpha1.SecretProviderClassSpec{
+				SecretObjects: []spcv1alpha1.SecretObject{{SecretName: "secret2"}},
+			},
+		}),
+	}
+	ns.volumes.add(publishedVolume{TargetPath: "/tracked", PodName: "pod1", PodNamespace: "ns1", PodUID: "uid1", SecretProviderClass: "spc1", SecretProviderClassNamespace: "ns1", SecretNames: []string{"secret1"}})
+	ns.volumes.add(publishedVolume{TargetPath: "/no-spc", PodName: "pod3", PodNamespace: "ns1", PodUID: "uid3", ProviderName: "provider1"})
+
+	// tracked volumes are read from the state
+	podStatus, secretNames, err := ns.getPublishedK8sObjects(ctx, "/tracked")
+	assert.NoError(t, err)
+	assert.Equal(t, getPodStatusName("uid1", ""), podStatus.Name)
+	assert.Equal(t, []string{"secret1"}, secretNames)
+
+	podStatus, _, err = ns.getPublishedK8sObjects(ctx, "/no-spc")
+	assert.NoError(t, err)
+	assert.Nil(t, podStatus)
+
+	// untracked volumes are looked up with the API server
+	podStatus, secretNames, err = ns.getPublishedK8sObjects(ctx, "/untracked")
+	assert.NoError(t, err)
+	assert.Equal(t, getPodStatusName("uid2", ""), podStatus.Name)
+	assert.Equal(t, []string{"secret2"}, secretNames)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretsstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/utils/mount"
+)
+
+func TestNodeGetVolumeStats(t *testing.T) {
+	targetPath, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+	if err := ioutil.WriteFile(filepath.Join(targetPath, "secret1"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ns, err := newNodeServer(NewFakeDriver(), Options{NodeID: "somenodeid"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.mounter = mount.NewFakeMounter([]mount.MountPoint{{Path: targetPath}})
+
+	_, err = ns.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{VolumeId: "vol1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = ns.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{VolumeId: "vol1", VolumePath: filepath.Join(targetPath, "missing")})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err := ns.NodeGetVolumeStats(context.Background(), &csi.NodeGetVolumeStatsRequest{VolumeId: "vol1", VolumePath: targetPath})
+	assert.NoError(t, err)
+	assert.Len(t, resp.GetUsage(), 2)
+	assert.Equal(t, csi.VolumeUsage_BYTES, resp.GetUsage()[0].GetUnit())
+	assert.Equal(t, csi.VolumeUsage_INODES, resp.GetUsage()[1].GetUnit())
+	assert.True(t, resp.GetUsage()[0].GetUsed() > 0)
+}
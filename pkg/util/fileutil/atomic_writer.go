@@ -0,0 +1,259 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DataDirName is the name of the symlink to the directory with the
+	// current generation of the files
+	DataDirName = "..data"
+	// newDataDirName is the temporary name of the symlink to a new
+	// generation before it's renamed to DataDirName
+	newDataDirName = "..data_tmp"
+	// generationDirPrefix is the prefix of the timestamped directories
+	generationDirPrefix = "..2006_01_02_15_04_05."
+)
+
+// FileProjection is the contents and mode of a file written by AtomicWriter
+type FileProjection struct {
+	Data []byte
+	Mode os.FileMode
+}
+
+// AtomicWriter writes a set of files to a target directory so that readers
+// always see a consistent generation of the files. It uses the same layout as
+// the kubelet AtomicWriter for ConfigMap and Secret volumes:
+//
+//	<target-dir>/..2020_06_01_10_00_00.123456789/<files>  timestamped generation
+//	<target-dir>/..data -> ..2020_06_01_10_00_00.123456789  current generation
+//	<target-dir>/<file> -> ..data/<file>                   user visible path
+//
+// Each write creates a new timestamped directory and atomically renames a
+// symlink to it over ..data. Older generations are removed after the swap.
+type AtomicWriter struct {
+	targetDir string
+}
+
+// NewAtomicWriter creates a new AtomicWriter for the existing target directory
+func NewAtomicWriter(targetDir string) (*AtomicWriter, error) {
+	fi, err := os.Stat(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("target path %s is not a directory", targetDir)
+	}
+	return &AtomicWriter{targetDir: targetDir}, nil
+}
+
+// Write writes the payload, keyed by the path relative to the target
+// directory, as a new generation and makes it the current one. The write is
+// skipped if the payload matches the current generation. It returns true if
+// the payload was written.
+func (w *AtomicWriter) Write(payload map[string]FileProjection) (bool, error) {
+	cleanPayload := make(map[string]FileProjection, len(payload))
+	for p, content := range payload {
+		if err := validatePath(p); err != nil {
+			return false, err
+		}
+		cleanPayload[filepath.Clean(p)] = content
+	}
+
+	dataDirPath := filepath.Join(w.targetDir, DataDirName)
+	oldGeneration, err := os.Readlink(dataDirPath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s, err: %v", dataDirPath, err)
+	}
+	oldVisiblePaths := make(map[string]struct{})
+	if len(oldGeneration) > 0 {
+		oldGenerationPath := filepath.Join(w.targetDir, oldGeneration)
+		equal, err := payloadEqual(cleanPayload, oldGenerationPath)
+		if err != nil {
+			return false, err
+		}
+		if equal {
+			log.Debugf("payload in %s is unchanged, skip writing", w.targetDir)
+			return false, nil
+		}
+		items, err := ioutil.ReadDir(oldGenerationPath)
+		if err != nil {
+			return false, err
+		}
+		for _, item := range items {
+			oldVisiblePaths[item.Name()] = struct{}{}
+		}
+	}
+
+	generationPath, err := ioutil.TempDir(w.targetDir, time.Now().UTC().Format(generationDirPrefix))
+	if err != nil {
+		return false, err
+	}
+	if err := writePayloadToDir(cleanPayload, generationPath); err != nil {
+		os.RemoveAll(generationPath)
+		return false, err
+	}
+
+	// swap the current generation by renaming a symlink to the new
+	// generation over DataDirName, which is atomic
+	newDataDirPath := filepath.Join(w.targetDir, newDataDirName)
+	if err := os.Remove(newDataDirPath); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(generationPath)
+		return false, err
+	}
+	if err := os.Symlink(filepath.Base(generationPath), newDataDirPath); err != nil {
+		os.RemoveAll(generationPath)
+		return false, err
+	}
+	if err := os.Rename(newDataDirPath, dataDirPath); err != nil {
+		os.Remove(newDataDirPath)
+		os.RemoveAll(generationPath)
+		return false, err
+	}
+
+	visiblePaths := make(map[string]struct{})
+	for p := range cleanPayload {
+		visiblePaths[strings.SplitN(filepath.ToSlash(p), "/", 2)[0]] = struct{}{}
+	}
+	if err := w.createUserVisiblePaths(visiblePaths); err != nil {
+		return false, err
+	}
+	for p := range oldVisiblePaths {
+		if _, exists := visiblePaths[p]; exists {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.targetDir, p)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return true, w.removeOldGenerations(filepath.Base(generationPath))
+}
+
+// createUserVisiblePaths creates the symlinks of the top level paths of the
+// payload to the same path in DataDirName
+func (w *AtomicWriter) createUserVisiblePaths(visiblePaths map[string]struct{}) error {
+	for p := range visiblePaths {
+		visiblePath := filepath.Join(w.targetDir, p)
+		if _, err := os.Lstat(visiblePath); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(filepath.Join(DataDirName, p), visiblePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeOldGenerations removes all the hidden entries in the target directory
+// except for the current generation. This also removes generations and
+// staging directories left behind by failed writes.
+func (w *AtomicWriter) removeOldGenerations(currentGeneration string) error {
+	items, err := ioutil.ReadDir(w.targetDir)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		name := item.Name()
+		if !strings.HasPrefix(name, "..") || name == DataDirName || name == currentGeneration {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(w.targetDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePayloadToDir writes the payload to the generation directory
+func writePayloadToDir(payload map[string]FileProjection, dir string) error {
+	// TempDir creates the directory with 0700
+	if err := os.Chmod(dir, 0755); err != nil {
+		return err
+	}
+	for p, content := range payload {
+		fullPath := filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fullPath, content.Data, content.Mode); err != nil {
+			return err
+		}
+		// WriteFile only sets the mode when it creates the file and is subject
+		// to the umask
+		if err := os.Chmod(fullPath, content.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// payloadEqual returns true if the generation directory contains exactly the
+// files of the payload with the same contents and mode
+func payloadEqual(payload map[string]FileProjection, dir string) (bool, error) {
+	count := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if count != len(payload) {
+		return false, nil
+	}
+	for p, content := range payload {
+		fullPath := filepath.Join(dir, p)
+		fi, err := os.Lstat(fullPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if !fi.Mode().IsRegular() || fi.Mode().Perm() != content.Mode.Perm() {
+			return false, nil
+		}
+		data, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(data, content.Data) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
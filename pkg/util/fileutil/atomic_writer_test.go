@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewAtomicWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := w.Write(map[string]FileProjection{
+		"foo":     {Data: []byte("foo"), Mode: 0644},
+		"bar/baz": {Data: []byte("baz"), Mode: 0600},
+	})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	generation, err := os.Readlink(filepath.Join(dir, DataDirName))
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "bar", "baz"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("baz"), data)
+	link, err := os.Readlink(filepath.Join(dir, "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(DataDirName, "foo"), link)
+
+	// writing the same payload doesn't create a new generation
+	changed, err = w.Write(map[string]FileProjection{
+		"foo":     {Data: []byte("foo"), Mode: 0644},
+		"bar/baz": {Data: []byte("baz"), Mode: 0600},
+	})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	sameGeneration, err := os.Readlink(filepath.Join(dir, DataDirName))
+	assert.NoError(t, err)
+	assert.Equal(t, generation, sameGeneration)
+
+	// leftover from a failed write
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..staging_1"), 0700))
+
+	changed, err = w.Write(map[string]FileProjection{
+		"foo": {Data: []byte("rotated"), Mode: 0644},
+	})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	newGeneration, err := os.Readlink(filepath.Join(dir, DataDirName))
+	assert.NoError(t, err)
+	assert.NotEqual(t, generation, newGeneration)
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("rotated"), data)
+
+	// removed files and old generations are cleaned up
+	items, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name())
+	}
+	assert.ElementsMatch(t, []string{DataDirName, newGeneration, "foo"}, names)
+}
+
+func TestAtomicWriterInvalidPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewAtomicWriter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write(map[string]FileProjection{"../foo": {Data: []byte("foo"), Mode: 0644}})
+	assert.Error(t, err)
+	_, err = os.Lstat(filepath.Join(dir, DataDirName))
+	assert.True(t, os.IsNotExist(err))
+}
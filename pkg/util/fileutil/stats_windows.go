@@ -0,0 +1,43 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// GetVolumeStats returns the usage of the path. The content isn't mounted
+// on a separate filesystem on windows, so only the bytes and inodes used by
+// the files in the path are reported.
+func GetVolumeStats(path string) (VolumeStats, error) {
+	var stats VolumeStats
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stats.UsedInodes++
+		if info.Mode().IsRegular() {
+			stats.UsedBytes += info.Size()
+		}
+		return nil
+	})
+	return stats, err
+}
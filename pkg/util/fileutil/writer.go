@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// MaxPayloadSize is the maximum total size in bytes of the files a
+	// provider can return for a single mount
+	MaxPayloadSize = 10 * 1024 * 1024
+	// maxFileMode are the only permission bits a provider can set on a file.
+	// Secrets are never executable and never writable by group or others.
+	maxFileMode os.FileMode = 0644
+)
+
+// Validate validates the files returned by a provider before they are
+// written to the target path. Paths must be relative, must not reference
+// the parent directory, must be unique, modes must not have bits outside of
+// 0644 and the total size of the contents must not exceed MaxPayloadSize.
+func Validate(payloads []*v1alpha1.File) error {
+	var size int
+	paths := make(map[string]struct{}, len(payloads))
+	for _, payload := range payloads {
+		if err := validatePath(payload.GetPath()); err != nil {
+			return err
+		}
+		p := filepath.Clean(payload.GetPath())
+		if _, exists := paths[p]; exists {
+			return fmt.Errorf("duplicate file path %s", payload.GetPath())
+		}
+		paths[p] = struct{}{}
+		if os.FileMode(payload.GetMode())&^maxFileMode != 0 {
+			return fmt.Errorf("file %s has invalid mode %#o", payload.GetPath(), payload.GetMode())
+		}
+		size += len(payload.GetContents())
+		if size > MaxPayloadSize {
+			return fmt.Errorf("total size of files exceeds %d bytes", MaxPayloadSize)
+		}
+	}
+	return nil
+}
+
+// validatePath validates a single file path
+func validatePath(p string) error {
+	if len(p) == 0 {
+		return fmt.Errorf("file path must not be empty")
+	}
+	if filepath.IsAbs(p) || strings.HasPrefix(p, "/") || strings.HasPrefix(p, `\`) {
+		return fmt.Errorf("file path %s must be relative", p)
+	}
+	for _, item := range strings.FieldsFunc(p, isPathSeparator) {
+		if item == ".." {
+			return fmt.Errorf("file path %s must not contain '..'", p)
+		}
+	}
+	if strings.HasPrefix(p, "..") {
+		return fmt.Errorf("file path %s must not start with '..'", p)
+	}
+	return nil
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// WritePayloads atomically replaces the files in the target path with the
+// payloads using AtomicWriter. Files are written with the mode of the payload
+// masked by the permission of the mount, or with the permission if the
+// payload has no mode, so providers can only restrict the permission. The
+// payloads are expected to be validated with Validate. It returns true if the
+// files changed.
+func WritePayloads(targetPath string, payloads []*v1alpha1.File, permission os.FileMode) (bool, error) {
+	w, err := NewAtomicWriter(targetPath)
+	if err != nil {
+		return false, err
+	}
+	files := make(map[string]FileProjection, len(payloads))
+	for _, payload := range payloads {
+		mode := permission
+		if payload.GetMode() != 0 {
+			mode = os.FileMode(payload.GetMode()) & permission
+		}
+		files[payload.GetPath()] = FileProjection{Data: payload.GetContents(), Mode: mode}
+	}
+	return w.Write(files)
+}
+
+// ReadPayloads returns the files written to dir, e.g. by providers that write
+// the files themselves, with paths relative to dir. Only regular files are
+// returned.
+func ReadPayloads(dir string) ([]*v1alpha1.File, error) {
+	var payloads []*v1alpha1.File
+	var size int
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		size += int(info.Size())
+		if size > MaxPayloadSize {
+			return fmt.Errorf("total size of files exceeds %d bytes", MaxPayloadSize)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// providers writing the files themselves are subject to their umask,
+		// only the permission bits allowed by Validate are kept
+		payloads = append(payloads, &v1alpha1.File{
+			Path:     filepath.ToSlash(rel),
+			Mode:     int32(info.Mode().Perm() & maxFileMode),
+			Contents: contents,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payloads, nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		desc        string
+		payloads    []*v1alpha1.File
+		expectedErr bool
+	}{
+		{
+			desc:     "valid files",
+			payloads: []*v1alpha1.File{{Path: "foo", Mode: 0644}, {Path: "bar/baz", Contents: []byte("secret")}},
+		},
+		{
+			desc:        "empty path",
+			payloads:    []*v1alpha1.File{{Path: ""}},
+			expectedErr: true,
+		},
+		{
+			desc:        "absolute path",
+			payloads:    []*v1alpha1.File{{Path: "/etc/passwd"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "path escaping target path",
+			payloads:    []*v1alpha1.File{{Path: "foo/../../bar"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "path with .. prefix",
+			payloads:    []*v1alpha1.File{{Path: "..data"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "duplicate path",
+			payloads:    []*v1alpha1.File{{Path: "foo"}, {Path: "./foo"}},
+			expectedErr: true,
+		},
+		{
+			desc:        "setuid mode",
+			payloads:    []*v1alpha1.File{{Path: "foo", Mode: int32(os.ModeSetuid | 0755)}},
+			expectedErr: true,
+		},
+		{
+			desc:        "executable mode",
+			payloads:    []*v1alpha1.File{{Path: "foo", Mode: 0755}},
+			expectedErr: true,
+		},
+		{
+			desc:        "group writable mode",
+			payloads:    []*v1alpha1.File{{Path: "foo", Mode: 0664}},
+			expectedErr: true,
+		},
+		{
+			desc:        "payload too large",
+			payloads:    []*v1alpha1.File{{Path: "foo", Contents: make([]byte, MaxPayloadSize)}, {Path: "bar", Contents: []byte("1")}},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := Validate(tc.payloads)
+			assert.Equal(t, tc.expectedErr, err != nil, "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestWritePayloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	payloads := []*v1alpha1.File{
+		{Path: "foo", Contents: []byte("foo")},
+		{Path: "bar/baz", Mode: 0600, Contents: []byte("baz")},
+		// the mode is masked by the permission of the mount
+		{Path: "qux", Mode: 0644, Contents: []byte("qux")},
+	}
+	changed, err := WritePayloads(dir, payloads, 0640)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	fi, err := os.Stat(filepath.Join(dir, "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	fi, err = os.Stat(filepath.Join(dir, "qux"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	fi, err = os.Stat(filepath.Join(dir, "bar", "baz"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "bar", "baz"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("baz"), data)
+
+	// the files are unchanged if the payloads are written again
+	changed, err = WritePayloads(dir, payloads, 0640)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestReadPayloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "bar"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0644))
+	assert.NoError(t, os.Chmod(filepath.Join(dir, "foo"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bar", "baz"), []byte("baz"), 0600))
+	assert.NoError(t, os.Chmod(filepath.Join(dir, "bar", "baz"), 0600))
+
+	payloads, err := ReadPayloads(dir)
+	assert.NoError(t, err)
+	assert.Len(t, payloads, 2)
+	for _, payload := range payloads {
+		switch payload.GetPath() {
+		case "foo":
+			assert.Equal(t, []byte("foo"), payload.GetContents())
+			assert.Equal(t, int32(0644), payload.GetMode())
+		case "bar/baz":
+			assert.Equal(t, []byte("baz"), payload.GetContents())
+			assert.Equal(t, int32(0600), payload.GetMode())
+		default:
+			t.Errorf("unexpected payload %s", payload.GetPath())
+		}
+	}
+}
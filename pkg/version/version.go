@@ -15,6 +15,7 @@ package version
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
@@ -22,6 +23,8 @@ import (
 
 	"github.com/blang/semver"
 	log "github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/secrets-store-csi-driver/pkg/util/cmdutil"
 )
 
 // providerVersion holds current provider version
@@ -31,24 +34,67 @@ type providerVersion struct {
 	// BuildDate is the date provider binary was built
 	BuildDate string `json:"buildDate"`
 	// MinDriverVersion is minimum driver version the provider works with
-	// this can be used later for bidirectional compatibility checks between driver-provider
 	MinDriverVersion string `json:"minDriverVersion"`
+	// Capabilities are the optional features of the driver-provider
+	// interface the provider supports
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// ProviderInfo is the version, the minimum driver version and the
+// capabilities a provider binary reports with --version
+type ProviderInfo struct {
+	Version          string
+	MinDriverVersion string
+	Capabilities     []string
 }
 
-// IsProviderCompatible checks if the provider version is compatible with
-// current driver version.
-func IsProviderCompatible(provider string, minProviderVersion string) (bool, error) {
-	// get current provider version
-	currProviderVersion, err := getProviderVersion(provider)
+// HasCapability returns true if the provider reported the capability
+func (p *ProviderInfo) HasCapability(capability string) bool {
+	for _, c := range p.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// IsProviderVersionCompatible checks if the provider version reported by a
+// provider is compatible with current driver version. providerVersions is
+// either the minimum provider version or a semver range such as
+// ">=0.0.5 <0.1.0".
+func IsProviderVersionCompatible(currProviderVersion string, providerVersions string) (bool, error) {
+	// check with normalized versions
+	return isProviderCompatible(normalizeVersion(currProviderVersion), providerVersions)
+}
+
+// IsDriverVersionCompatible checks if the driver version is at least the
+// minimum driver version reported by a provider. Providers that don't report
+// a minimum driver version work with any driver version.
+func IsDriverVersionCompatible(driverVersion string, minDriverVersion string) (bool, error) {
+	if minDriverVersion == "" {
+		return true, nil
+	}
+	currV, err := semver.Make(normalizeVersion(driverVersion))
 	if err != nil {
 		return false, err
 	}
-	// check with normalized versions
-	return isProviderCompatible(normalizeVersion(currProviderVersion), normalizeVersion(minProviderVersion))
+	minV, err := semver.Make(normalizeVersion(minDriverVersion))
+	if err != nil {
+		return false, fmt.Errorf("minimum driver version %s is not a valid semver, error %+v", minDriverVersion, err)
+	}
+	return currV.Compare(minV) >= 0, nil
+}
+
+// IsVersionRange returns true if providerVersions is a semver range rather
+// than a minimum provider version.
+func IsVersionRange(providerVersions string) bool {
+	return isValidSemver(normalizeVersion(providerVersions)) != nil
 }
 
-// GetMinimumProviderVersions creates a map with provider name and minimum version
-// supported with this driver.
+// GetMinimumProviderVersions creates a map with provider name and the
+// versions supported with this driver. The versions of a provider are either
+// the minimum version or a semver range, for example
+// "provider1=0.0.4,provider2=>=0.0.5 <0.1.0".
 func GetMinimumProviderVersions(minProviderVersions string) (map[string]string, error) {
 	providerVersionMap := make(map[string]string)
 
@@ -60,7 +106,8 @@ func GetMinimumProviderVersions(minProviderVersions string) (map[string]string,
 	providers := strings.Split(minProviderVersions, ",")
 	for _, p := range providers {
 		p = strings.TrimSpace(p)
-		pv := strings.Split(p, "=")
+		// semver ranges contain = in their operators
+		pv := strings.SplitN(p, "=", 2)
 
 		if len(pv) != 2 {
 			return providerVersionMap, fmt.Errorf("min provider version not defined in expected format, got %+v", pv)
@@ -77,9 +124,9 @@ func GetMinimumProviderVersions(minProviderVersions string) (map[string]string,
 		if v, exists := providerVersionMap[provider]; exists {
 			return providerVersionMap, fmt.Errorf("duplicate versions defined for %s provider, versions: [%s, %s]", provider, v, version)
 		}
-		// check if provided version is a valid semver
-		if err := isValidSemver(version); err != nil {
-			return providerVersionMap, fmt.Errorf("minimum %s provider version %s is not a valid semver, error %+v", provider, version, err)
+		// check if provided version is a valid semver or semver range
+		if _, err := parseProviderVersions(version); err != nil {
+			return providerVersionMap, fmt.Errorf("%s provider versions %s are not a valid semver or semver range, error %+v", provider, version, err)
 		}
 
 		providerVersionMap[provider] = version
@@ -89,36 +136,50 @@ func GetMinimumProviderVersions(minProviderVersions string) (map[string]string,
 	return providerVersionMap, nil
 }
 
-func getProviderVersion(providerName string) (string, error) {
+// GetProviderInfo returns the version and the capabilities reported by the
+// provider binary. The provider is killed if ctx is done before it reports
+// its version.
+func GetProviderInfo(ctx context.Context, providerName string) (*ProviderInfo, error) {
 	cmd := exec.Command(providerName, "--version")
 
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
 	cmd.Stderr, cmd.Stdout = stderr, stdout
 
-	err := cmd.Run()
+	err := cmdutil.Run(ctx, cmd)
 	if err != nil {
-		return "", fmt.Errorf("error getting current provider version for %s, err: %v, output: %v", providerName, err, stderr.String())
+		return nil, fmt.Errorf("error getting current provider version for %s, err: %v, output: %v", providerName, err, stderr.String())
 	}
 	var pv providerVersion
 	if err := json.Unmarshal(stdout.Bytes(), &pv); err != nil {
-		return "", fmt.Errorf("error unmarshalling provider version %v", err)
+		return nil, fmt.Errorf("error unmarshalling provider version %v", err)
 	}
 
-	log.Debugf("provider: %s, version %s, build date: %s", providerName, pv.Version, pv.BuildDate)
-	return pv.Version, nil
+	log.Debugf("provider: %s, version %s, build date: %s, min driver version: %s, capabilities: %v", providerName, pv.Version, pv.BuildDate, pv.MinDriverVersion, pv.Capabilities)
+	return &ProviderInfo{Version: pv.Version, MinDriverVersion: pv.MinDriverVersion, Capabilities: pv.Capabilities}, nil
 }
 
-func isProviderCompatible(currVersion, minVersion string) (bool, error) {
+func isProviderCompatible(currVersion, providerVersions string) (bool, error) {
 	currV, err := semver.Make(currVersion)
 	if err != nil {
 		return false, err
 	}
-	minV, err := semver.Make(minVersion)
+	versionRange, err := parseProviderVersions(providerVersions)
 	if err != nil {
 		return false, err
 	}
-	return currV.Compare(minV) >= 0, nil
+	return versionRange(currV), nil
+}
+
+// parseProviderVersions parses the minimum provider version or the semver
+// range of provider versions supported with the driver.
+func parseProviderVersions(providerVersions string) (semver.Range, error) {
+	if minV, err := semver.Make(normalizeVersion(providerVersions)); err == nil {
+		return func(v semver.Version) bool {
+			return v.Compare(minV) >= 0
+		}, nil
+	}
+	return semver.ParseRange(providerVersions)
 }
 
 func isValidSemver(version string) error {
@@ -128,7 +189,5 @@ func isValidSemver(version string) error {
 
 func normalizeVersion(version string) string {
 	// driver currently uses prefix in version
-	// no checks are currently performed using driver version, but
-	// will be done in the future for bi-directional version validation.
 	return strings.TrimPrefix(version, "v")
 }
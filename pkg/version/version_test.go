@@ -97,6 +97,18 @@ func TestGetMinimumProviderVersions(t *testing.T) {
 			expectedMap:         map[string]string{"provider1": "0.0.2", "provider2": "0.0.4"},
 			expectedErr:         false,
 		},
+		{
+			desc:                "provider version range",
+			minProviderVersions: "provider1=>=0.0.5 <0.1.0, provider2=0.0.4",
+			expectedMap:         map[string]string{"provider1": ">=0.0.5 <0.1.0", "provider2": "0.0.4"},
+			expectedErr:         false,
+		},
+		{
+			desc:                "invalid provider version range",
+			minProviderVersions: "provider1=>=0.0.5 <abc",
+			expectedMap:         make(map[string]string),
+			expectedErr:         true,
+		},
 		{
 			desc:                "minProviderVersions is not provided",
 			minProviderVersions: "",
@@ -160,6 +172,34 @@ func TestIsProviderCompatible(t *testing.T) {
 			expected:    true,
 			expectedErr: false,
 		},
+		{
+			desc:        "curr version in range",
+			currVersion: "0.0.6",
+			minVersion:  ">=0.0.5 <0.1.0",
+			expected:    true,
+			expectedErr: false,
+		},
+		{
+			desc:        "curr version > range",
+			currVersion: "0.1.0",
+			minVersion:  ">=0.0.5 <0.1.0",
+			expected:    false,
+			expectedErr: false,
+		},
+		{
+			desc:        "curr version in one of the ranges",
+			currVersion: "0.2.1",
+			minVersion:  ">=0.0.5 <0.1.0 || >=0.2.0",
+			expected:    true,
+			expectedErr: false,
+		},
+		{
+			desc:        "invalid range",
+			currVersion: "0.0.6",
+			minVersion:  ">=0.0.5 <abc",
+			expected:    false,
+			expectedErr: true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -173,3 +213,60 @@ func TestIsProviderCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestProviderInfoHasCapability(t *testing.T) {
+	info := &ProviderInfo{Version: "0.0.10", Capabilities: []string{"stdinPayload"}}
+	if !info.HasCapability("stdinPayload") {
+		t.Fatalf("expected capability stdinPayload")
+	}
+	if info.HasCapability("unknown") {
+		t.Fatalf("unexpected capability unknown")
+	}
+}
+
+func TestIsDriverVersionCompatible(t *testing.T) {
+	cases := []struct {
+		desc             string
+		driverVersion    string
+		minDriverVersion string
+		expected         bool
+		expectedErr      bool
+	}{
+		{
+			desc:             "min driver version not reported",
+			driverVersion:    "0.0.9",
+			minDriverVersion: "",
+			expected:         true,
+		},
+		{
+			desc:             "driver version < min driver version",
+			driverVersion:    "0.0.9",
+			minDriverVersion: "v0.0.10",
+			expected:         false,
+		},
+		{
+			desc:             "driver version = min driver version",
+			driverVersion:    "v0.0.10",
+			minDriverVersion: "0.0.10",
+			expected:         true,
+		},
+		{
+			desc:             "invalid min driver version",
+			driverVersion:    "0.0.9",
+			minDriverVersion: "latest",
+			expected:         false,
+			expectedErr:      true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Log(i, tc.desc)
+		actual, err := IsDriverVersionCompatible(tc.driverVersion, tc.minDriverVersion)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("expected error: %v, actual: %v", tc.expectedErr, err)
+		}
+		if tc.expected != actual {
+			t.Fatalf("expected: %v, actual: %v", tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,710 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: service.proto
+
+package v1alpha1
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type VersionRequest struct {
+	// Version of the provider API the driver is using
+	Version              string   `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VersionRequest) Reset()         { *m = VersionRequest{} }
+func (m *VersionRequest) String() string { return proto.CompactTextString(m) }
+func (*VersionRequest) ProtoMessage()    {}
+func (*VersionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{0}
+}
+
+func (m *VersionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VersionRequest.Unmarshal(m, b)
+}
+func (m *VersionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VersionRequest.Marshal(b, m, deterministic)
+}
+func (m *VersionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VersionRequest.Merge(m, src)
+}
+func (m *VersionRequest) XXX_Size() int {
+	return xxx_messageInfo_VersionRequest.Size(m)
+}
+func (m *VersionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_VersionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VersionRequest proto.InternalMessageInfo
+
+func (m *VersionRequest) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+type VersionResponse struct {
+	// Version of the provider API the provider is using
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// Name of the provider
+	RuntimeName string `protobuf:"bytes,2,opt,name=runtime_name,json=runtimeName,proto3" json:"runtime_name,omitempty"`
+	// Version of the provider binary
+	RuntimeVersion string `protobuf:"bytes,3,opt,name=runtime_version,json=runtimeVersion,proto3" json:"runtime_version,omitempty"`
+	// Minimum version of the driver the provider works with, empty if the
+	// provider works with any driver version
+	MinDriverVersion     string   `protobuf:"bytes,4,opt,name=min_driver_version,json=minDriverVersion,proto3" json:"min_driver_version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VersionResponse) Reset()         { *m = VersionResponse{} }
+func (m *VersionResponse) String() string { return proto.CompactTextString(m) }
+func (*VersionResponse) ProtoMessage()    {}
+func (*VersionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{1}
+}
+
+func (m *VersionResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VersionResponse.Unmarshal(m, b)
+}
+func (m *VersionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VersionResponse.Marshal(b, m, deterministic)
+}
+func (m *VersionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VersionResponse.Merge(m, src)
+}
+func (m *VersionResponse) XXX_Size() int {
+	return xxx_messageInfo_VersionResponse.Size(m)
+}
+func (m *VersionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_VersionResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VersionResponse proto.InternalMessageInfo
+
+func (m *VersionResponse) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *VersionResponse) GetRuntimeName() string {
+	if m != nil {
+		return m.RuntimeName
+	}
+	return ""
+}
+
+func (m *VersionResponse) GetRuntimeVersion() string {
+	if m != nil {
+		return m.RuntimeVersion
+	}
+	return ""
+}
+
+func (m *VersionResponse) GetMinDriverVersion() string {
+	if m != nil {
+		return m.MinDriverVersion
+	}
+	return ""
+}
+
+type MountRequest struct {
+	// Attributes is the JSON encoded map of parameters from the
+	// SecretProviderClass together with the pod information
+	Attributes string `protobuf:"bytes,1,opt,name=attributes,proto3" json:"attributes,omitempty"`
+	// Secrets is the JSON encoded map of nodePublishSecretRef contents
+	Secrets string `protobuf:"bytes,2,opt,name=secrets,proto3" json:"secrets,omitempty"`
+	// TargetPath is the path the objects are expected to be written to
+	TargetPath string `protobuf:"bytes,3,opt,name=target_path,json=targetPath,proto3" json:"target_path,omitempty"`
+	// Permission is the JSON encoded file permission for the objects
+	Permission string `protobuf:"bytes,4,opt,name=permission,proto3" json:"permission,omitempty"`
+	// CurrentObjectVersion is the list of object versions currently mounted
+	CurrentObjectVersion []*ObjectVersion `protobuf:"bytes,5,rep,name=current_object_version,json=currentObjectVersion,proto3" json:"current_object_version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *MountRequest) Reset()         { *m = MountRequest{} }
+func (m *MountRequest) String() string { return proto.CompactTextString(m) }
+func (*MountRequest) ProtoMessage()    {}
+func (*MountRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{2}
+}
+
+func (m *MountRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MountRequest.Unmarshal(m, b)
+}
+func (m *MountRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MountRequest.Marshal(b, m, deterministic)
+}
+func (m *MountRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MountRequest.Merge(m, src)
+}
+func (m *MountRequest) XXX_Size() int {
+	return xxx_messageInfo_MountRequest.Size(m)
+}
+func (m *MountRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MountRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MountRequest proto.InternalMessageInfo
+
+func (m *MountRequest) GetAttributes() string {
+	if m != nil {
+		return m.Attributes
+	}
+	return ""
+}
+
+func (m *MountRequest) GetSecrets() string {
+	if m != nil {
+		return m.Secrets
+	}
+	return ""
+}
+
+func (m *MountRequest) GetTargetPath() string {
+	if m != nil {
+		return m.TargetPath
+	}
+	return ""
+}
+
+func (m *MountRequest) GetPermission() string {
+	if m != nil {
+		return m.Permission
+	}
+	return ""
+}
+
+func (m *MountRequest) GetCurrentObjectVersion() []*ObjectVersion {
+	if m != nil {
+		return m.CurrentObjectVersion
+	}
+	return nil
+}
+
+type MountResponse struct {
+	// ObjectVersion is the list of object versions that were mounted
+	ObjectVersion []*ObjectVersion `protobuf:"bytes,1,rep,name=object_version,json=objectVersion,proto3" json:"object_version,omitempty"`
+	// Error is set when the provider failed to mount the objects
+	Error *Error `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	// Files is the list of files the driver writes to the target path.
+	// Providers returning files must not write to the target path themselves.
+	Files                []*File  `protobuf:"bytes,3,rep,name=files,proto3" json:"files,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MountResponse) Reset()         { *m = MountResponse{} }
+func (m *MountResponse) String() string { return proto.CompactTextString(m) }
+func (*MountResponse) ProtoMessage()    {}
+func (*MountResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{3}
+}
+
+func (m *MountResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MountResponse.Unmarshal(m, b)
+}
+func (m *MountResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MountResponse.Marshal(b, m, deterministic)
+}
+func (m *MountResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MountResponse.Merge(m, src)
+}
+func (m *MountResponse) XXX_Size() int {
+	return xxx_messageInfo_MountResponse.Size(m)
+}
+func (m *MountResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_MountResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MountResponse proto.InternalMessageInfo
+
+func (m *MountResponse) GetObjectVersion() []*ObjectVersion {
+	if m != nil {
+		return m.ObjectVersion
+	}
+	return nil
+}
+
+func (m *MountResponse) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *MountResponse) GetFiles() []*File {
+	if m != nil {
+		return m.Files
+	}
+	return nil
+}
+
+type ObjectVersion struct {
+	// Id of the secrets store object
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Version of the secrets store object
+	Version              string   `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ObjectVersion) Reset()         { *m = ObjectVersion{} }
+func (m *ObjectVersion) String() string { return proto.CompactTextString(m) }
+func (*ObjectVersion) ProtoMessage()    {}
+func (*ObjectVersion) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{4}
+}
+
+func (m *ObjectVersion) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ObjectVersion.Unmarshal(m, b)
+}
+func (m *ObjectVersion) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ObjectVersion.Marshal(b, m, deterministic)
+}
+func (m *ObjectVersion) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ObjectVersion.Merge(m, src)
+}
+func (m *ObjectVersion) XXX_Size() int {
+	return xxx_messageInfo_ObjectVersion.Size(m)
+}
+func (m *ObjectVersion) XXX_DiscardUnknown() {
+	xxx_messageInfo_ObjectVersion.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ObjectVersion proto.InternalMessageInfo
+
+func (m *ObjectVersion) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *ObjectVersion) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+type File struct {
+	// Path of the file relative to the target path
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// Mode is the file permission bits, at most 0644 and masked by the mount
+	// permission. The mount permission is used when unset
+	Mode int32 `protobuf:"varint,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	// Contents of the file
+	Contents             []byte   `protobuf:"bytes,3,opt,name=contents,proto3" json:"contents,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *File) Reset()         { *m = File{} }
+func (m *File) String() string { return proto.CompactTextString(m) }
+func (*File) ProtoMessage()    {}
+func (*File) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{5}
+}
+
+func (m *File) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_File.Unmarshal(m, b)
+}
+func (m *File) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_File.Marshal(b, m, deterministic)
+}
+func (m *File) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_File.Merge(m, src)
+}
+func (m *File) XXX_Size() int {
+	return xxx_messageInfo_File.Size(m)
+}
+func (m *File) XXX_DiscardUnknown() {
+	xxx_messageInfo_File.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_File proto.InternalMessageInfo
+
+func (m *File) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *File) GetMode() int32 {
+	if m != nil {
+		return m.Mode
+	}
+	return 0
+}
+
+func (m *File) GetContents() []byte {
+	if m != nil {
+		return m.Contents
+	}
+	return nil
+}
+
+type Error struct {
+	// Code is a provider defined machine readable error code
+	Code                 string   `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Error) Reset()         { *m = Error{} }
+func (m *Error) String() string { return proto.CompactTextString(m) }
+func (*Error) ProtoMessage()    {}
+func (*Error) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{6}
+}
+
+func (m *Error) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Error.Unmarshal(m, b)
+}
+func (m *Error) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Error.Marshal(b, m, deterministic)
+}
+func (m *Error) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Error.Merge(m, src)
+}
+func (m *Error) XXX_Size() int {
+	return xxx_messageInfo_Error.Size(m)
+}
+func (m *Error) XXX_DiscardUnknown() {
+	xxx_messageInfo_Error.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Error proto.InternalMessageInfo
+
+func (m *Error) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
+type HealthRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthRequest) Reset()         { *m = HealthRequest{} }
+func (m *HealthRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthRequest) ProtoMessage()    {}
+func (*HealthRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{7}
+}
+
+func (m *HealthRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthRequest.Unmarshal(m, b)
+}
+func (m *HealthRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthRequest.Marshal(b, m, deterministic)
+}
+func (m *HealthRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthRequest.Merge(m, src)
+}
+func (m *HealthRequest) XXX_Size() int {
+	return xxx_messageInfo_HealthRequest.Size(m)
+}
+func (m *HealthRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthRequest proto.InternalMessageInfo
+
+type HealthResponse struct {
+	// Healthy is true when the provider can serve mount requests
+	Healthy bool `protobuf:"varint,1,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	// Message describes the reason the provider is not healthy
+	Message              string   `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HealthResponse) Reset()         { *m = HealthResponse{} }
+func (m *HealthResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthResponse) ProtoMessage()    {}
+func (*HealthResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a0b84a42fa06f626, []int{8}
+}
+
+func (m *HealthResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HealthResponse.Unmarshal(m, b)
+}
+func (m *HealthResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HealthResponse.Marshal(b, m, deterministic)
+}
+func (m *HealthResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HealthResponse.Merge(m, src)
+}
+func (m *HealthResponse) XXX_Size() int {
+	return xxx_messageInfo_HealthResponse.Size(m)
+}
+func (m *HealthResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HealthResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HealthResponse proto.InternalMessageInfo
+
+func (m *HealthResponse) GetHealthy() bool {
+	if m != nil {
+		return m.Healthy
+	}
+	return false
+}
+
+func (m *HealthResponse) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*VersionRequest)(nil), "v1alpha1.VersionRequest")
+	proto.RegisterType((*VersionResponse)(nil), "v1alpha1.VersionResponse")
+	proto.RegisterType((*MountRequest)(nil), "v1alpha1.MountRequest")
+	proto.RegisterType((*MountResponse)(nil), "v1alpha1.MountResponse")
+	proto.RegisterType((*ObjectVersion)(nil), "v1alpha1.ObjectVersion")
+	proto.RegisterType((*File)(nil), "v1alpha1.File")
+	proto.RegisterType((*Error)(nil), "v1alpha1.Error")
+	proto.RegisterType((*HealthRequest)(nil), "v1alpha1.HealthRequest")
+	proto.RegisterType((*HealthResponse)(nil), "v1alpha1.HealthResponse")
+}
+
+func init() { proto.RegisterFile("service.proto", fileDescriptor_a0b84a42fa06f626) }
+
+var fileDescriptor_a0b84a42fa06f626 = []byte{
+	// 549 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x54, 0xdf, 0x8b, 0xd3, 0x40,
+	0x10, 0x36, 0x6d, 0x73, 0x57, 0xa7, 0x6d, 0xaa, 0x8b, 0xdc, 0xc5, 0x0a, 0x7a, 0x06, 0xc5, 0x43,
+	0x6c, 0xcb, 0x55, 0x90, 0x53, 0x50, 0x44, 0x4f, 0x51, 0xe1, 0xf4, 0x88, 0xe0, 0x83, 0x2f, 0x65,
+	0x9b, 0x8e, 0xed, 0x6a, 0xb3, 0x1b, 0x77, 0xb7, 0x05, 0xff, 0x17, 0x5f, 0xfd, 0x7f, 0x7c, 0xf4,
+	0xcf, 0x91, 0xec, 0x8f, 0x36, 0xf5, 0xd4, 0xb7, 0x9d, 0x6f, 0xbe, 0xf9, 0x32, 0x33, 0xfb, 0x6d,
+	0xa0, 0xa3, 0x50, 0xae, 0x58, 0x86, 0x83, 0x42, 0x0a, 0x2d, 0x48, 0x73, 0x75, 0x44, 0x17, 0xc5,
+	0x9c, 0x1e, 0x25, 0x77, 0x21, 0xfa, 0x80, 0x52, 0x31, 0xc1, 0x53, 0xfc, 0xba, 0x44, 0xa5, 0x49,
+	0x0c, 0xbb, 0x2b, 0x8b, 0xc4, 0xc1, 0x41, 0x70, 0x78, 0x31, 0xf5, 0x61, 0xf2, 0x23, 0x80, 0xee,
+	0x9a, 0xac, 0x0a, 0xc1, 0x15, 0xfe, 0x9b, 0x4d, 0x6e, 0x42, 0x5b, 0x2e, 0xb9, 0x66, 0x39, 0x8e,
+	0x39, 0xcd, 0x31, 0xae, 0x99, 0x74, 0xcb, 0x61, 0x6f, 0x69, 0x8e, 0xe4, 0x0e, 0x74, 0x3d, 0xc5,
+	0x8b, 0xd4, 0x0d, 0x2b, 0x72, 0xb0, 0xfb, 0x1a, 0xb9, 0x07, 0x24, 0x67, 0x7c, 0x3c, 0x95, 0x6c,
+	0x85, 0x72, 0xcd, 0x6d, 0x18, 0xee, 0xa5, 0x9c, 0xf1, 0x13, 0x93, 0x70, 0xec, 0xe4, 0x57, 0x00,
+	0xed, 0x53, 0xb1, 0xe4, 0xda, 0x8f, 0x74, 0x1d, 0x80, 0x6a, 0x2d, 0xd9, 0x64, 0xa9, 0x51, 0xb9,
+	0x3e, 0x2b, 0x48, 0x39, 0x84, 0xc2, 0x4c, 0xa2, 0x56, 0xae, 0x4b, 0x1f, 0x92, 0x1b, 0xd0, 0xd2,
+	0x54, 0xce, 0x50, 0x8f, 0x0b, 0xaa, 0xe7, 0xae, 0x3b, 0xb0, 0xd0, 0x19, 0xd5, 0xf3, 0x52, 0xba,
+	0x40, 0x99, 0x33, 0x55, 0xe9, 0xa8, 0x82, 0x90, 0x53, 0xd8, 0xcb, 0x96, 0x52, 0x22, 0xd7, 0x63,
+	0x31, 0xf9, 0x8c, 0x99, 0x5e, 0x77, 0x1f, 0x1e, 0xd4, 0x0f, 0x5b, 0xa3, 0xfd, 0x81, 0xbf, 0x8a,
+	0xc1, 0x3b, 0x93, 0xf7, 0x0b, 0xbe, 0xe2, 0xca, 0xb6, 0xd0, 0xe4, 0x7b, 0x00, 0x1d, 0x37, 0x9a,
+	0xbb, 0x80, 0x27, 0x10, 0xfd, 0x21, 0x1c, 0xfc, 0x5f, 0xb8, 0x23, 0xaa, 0x21, 0xb9, 0x0d, 0x21,
+	0x4a, 0x29, 0xa4, 0x99, 0xbc, 0x35, 0xea, 0x6e, 0xca, 0x5e, 0x94, 0x70, 0x6a, 0xb3, 0xe4, 0x16,
+	0x84, 0x9f, 0xd8, 0x02, 0x55, 0x5c, 0x37, 0xea, 0xd1, 0x86, 0xf6, 0x92, 0x2d, 0x30, 0xb5, 0xc9,
+	0xe4, 0x21, 0x74, 0xb6, 0x3e, 0x46, 0x22, 0xa8, 0xb1, 0xa9, 0xdb, 0x78, 0x8d, 0x4d, 0xab, 0x76,
+	0xa9, 0x6d, 0x9b, 0xeb, 0x0d, 0x34, 0x4a, 0x25, 0x42, 0xa0, 0x61, 0x56, 0x6d, 0x6b, 0xcc, 0xb9,
+	0xc4, 0x72, 0x31, 0xb5, 0x16, 0x0a, 0x53, 0x73, 0x26, 0x3d, 0x68, 0x66, 0x82, 0x6b, 0xe4, 0x5a,
+	0x99, 0x6b, 0x69, 0xa7, 0xeb, 0x38, 0xb9, 0x06, 0xa1, 0x69, 0xbe, 0x2c, 0xcc, 0xca, 0x42, 0x27,
+	0x56, 0x9e, 0x93, 0x2e, 0x74, 0x5e, 0x21, 0x5d, 0xe8, 0xb9, 0x73, 0x47, 0x72, 0x02, 0x91, 0x07,
+	0x36, 0xa6, 0x9e, 0x1b, 0xe4, 0x9b, 0xa9, 0x6c, 0xa6, 0x3e, 0x2c, 0x33, 0x39, 0x2a, 0x45, 0x67,
+	0xde, 0xcf, 0x3e, 0x1c, 0xfd, 0x0c, 0xe0, 0xf2, 0xf3, 0xf7, 0xaf, 0xad, 0x13, 0xcf, 0xa4, 0x58,
+	0xb1, 0x29, 0x4a, 0xf2, 0x14, 0x76, 0xfd, 0x2a, 0xe2, 0xcd, 0xca, 0xb6, 0x5f, 0x5c, 0xef, 0xea,
+	0x5f, 0x32, 0xb6, 0x93, 0xe4, 0x02, 0x79, 0x04, 0xa1, 0xb9, 0x70, 0xb2, 0xb7, 0x61, 0x55, 0xcd,
+	0xdd, 0xdb, 0x3f, 0x87, 0xaf, 0x6b, 0x1f, 0xc3, 0x8e, 0x9d, 0x8c, 0x54, 0x48, 0x5b, 0xc3, 0xf7,
+	0xe2, 0xf3, 0x09, 0x5f, 0xfe, 0xec, 0xf8, 0xe3, 0x03, 0xc5, 0x66, 0x6a, 0xf0, 0xe5, 0x58, 0x0d,
+	0x98, 0x18, 0xba, 0x37, 0xd1, 0x57, 0x5a, 0x48, 0xec, 0x67, 0x8a, 0xf5, 0xed, 0x7b, 0x1c, 0x16,
+	0x6e, 0xda, 0xa1, 0x97, 0x9a, 0xec, 0x98, 0xdf, 0xcc, 0xfd, 0xdf, 0x03, 0x00, 0x58, 0xa7, 0xf8,
+	0xb9, 0x77, 0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// CSIDriverProviderClient is the client API for CSIDriverProvider service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type CSIDriverProviderClient interface {
+	// Version returns the runtime information of the provider
+	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
+	// Mount fetches the secrets store objects and makes them available
+	// in the target path
+	Mount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*MountResponse, error)
+	// Health reports whether the provider is able to serve mount requests
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+}
+
+type cSIDriverProviderClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCSIDriverProviderClient(cc *grpc.ClientConn) CSIDriverProviderClient {
+	return &cSIDriverProviderClient{cc}
+}
+
+func (c *cSIDriverProviderClient) Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error) {
+	out := new(VersionResponse)
+	err := c.cc.Invoke(ctx, "/v1alpha1.CSIDriverProvider/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cSIDriverProviderClient) Mount(ctx context.Context, in *MountRequest, opts ...grpc.CallOption) (*MountResponse, error) {
+	out := new(MountResponse)
+	err := c.cc.Invoke(ctx, "/v1alpha1.CSIDriverProvider/Mount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cSIDriverProviderClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, "/v1alpha1.CSIDriverProvider/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CSIDriverProviderServer is the server API for CSIDriverProvider service.
+type CSIDriverProviderServer interface {
+	// Version returns the runtime information of the provider
+	Version(context.Context, *VersionRequest) (*VersionResponse, error)
+	// Mount fetches the secrets store objects and makes them available
+	// in the target path
+	Mount(context.Context, *MountRequest) (*MountResponse, error)
+	// Health reports whether the provider is able to serve mount requests
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+}
+
+// UnimplementedCSIDriverProviderServer can be embedded to have forward compatible implementations.
+type UnimplementedCSIDriverProviderServer struct {
+}
+
+func (*UnimplementedCSIDriverProviderServer) Version(ctx context.Context, req *VersionRequest) (*VersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
+func (*UnimplementedCSIDriverProviderServer) Mount(ctx context.Context, req *MountRequest) (*MountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Mount not implemented")
+}
+func (*UnimplementedCSIDriverProviderServer) Health(ctx context.Context, req *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+
+func RegisterCSIDriverProviderServer(s *grpc.Server, srv CSIDriverProviderServer) {
+	s.RegisterService(&_CSIDriverProvider_serviceDesc, srv)
+}
+
+func _CSIDriverProvider_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CSIDriverProviderServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1alpha1.CSIDriverProvider/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CSIDriverProviderServer).Version(ctx, req.(*VersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CSIDriverProvider_Mount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CSIDriverProviderServer).Mount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1alpha1.CSIDriverProvider/Mount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CSIDriverProviderServer).Mount(ctx, req.(*MountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CSIDriverProvider_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CSIDriverProviderServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1alpha1.CSIDriverProvider/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CSIDriverProviderServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _CSIDriverProvider_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "v1alpha1.CSIDriverProvider",
+	HandlerType: (*CSIDriverProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Version",
+			Handler:    _CSIDriverProvider_Version_Handler,
+		},
+		{
+			MethodName: "Mount",
+			Handler:    _CSIDriverProvider_Mount_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _CSIDriverProvider_Health_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "service.proto",
+}
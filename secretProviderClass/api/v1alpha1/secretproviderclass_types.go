@@ -17,18 +17,102 @@ const (
 	Vault Provider = "Vault"
 )
 
+// DeletionPolicy is the policy of deleting the K8s secret synced from a
+// secret object
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the K8s secret when no pod uses it
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the K8s secret when no pod uses it
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+const (
+	// ManagedLabel is the label of the K8s secrets synced by the driver
+	ManagedLabel = "secrets-store.csi.k8s.io/managed"
+	// SecretProviderClassAnnotation is the annotation of the K8s secrets
+	// synced by the driver with the namespace/name of the secretproviderclass
+	// the secret is synced from
+	SecretProviderClassAnnotation = "secrets-store.csi.k8s.io/secret-provider-class"
+	// AdoptAnnotation set to "true" on an existing K8s secret lets the driver
+	// take over the secret and sync it from a secretproviderclass
+	AdoptAnnotation = "secrets-store.csi.k8s.io/adopt"
+)
+
+// Decoding is the encoding of a value to decode
+type Decoding string
+
+const (
+	// DecodingBase64 decodes base64 encoded values
+	DecodingBase64 Decoding = "base64"
+	// DecodingHex decodes hex encoded values
+	DecodingHex Decoding = "hex"
+)
+
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// SecretObjectData defines the desired state of synced K8s secret object data
+type SecretObjectData struct {
+	// name of the object to sync
+	// +kubebuilder:validation:MinLength=1
+	ObjectName string `json:"objectName"`
+	// data field to populate
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+	// JSONPath of the field of the JSON or YAML object to populate the data
+	// field with, e.g. {.password}. The whole object is used if not set
+	// +optional
+	JSONPath string `json:"jsonPath,omitempty"`
+	// decoding of the object or of its field, base64 or hex. The value is
+	// used as is if not set
+	// +kubebuilder:validation:Enum=base64;hex
+	// +optional
+	Decode Decoding `json:"decode,omitempty"`
+}
+
+// SecretObject defines the desired state of synced K8s secret objects
+type SecretObject struct {
+	// name of the K8s secret object
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+	// type of K8s secret object
+	// +kubebuilder:validation:MinLength=1
+	Type string `json:"type"`
+	// data array to populate
+	// +kubebuilder:validation:MinItems=1
+	Data []SecretObjectData `json:"data"`
+	// deletion policy of the K8s secret object when no pod uses it, Delete
+	// by default
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
 // SecretProviderClassSpec defines the desired state of SecretProviderClass
 type SecretProviderClassSpec struct {
 	// Configuration for provider name
 	Provider Provider `json:"provider,omitempty"`
 	// Configuration for specific provider
 	Parameters map[string]string `json:"parameters,omitempty"`
+	// Configuration for K8s secrets synced from the mounted content
+	SecretObjects []SecretObject `json:"secretObjects,omitempty"`
+}
+
+// ByPodStatus defines the state of SecretProviderClass as seen by an individual pod
+type ByPodStatus struct {
+	// id of the pod that wrote the status
+	ID string `json:"id,omitempty"`
+	// namespace of the pod that wrote the status
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // SecretProviderClassStatus defines the observed state of SecretProviderClass
 type SecretProviderClassStatus struct {
+	// pods with K8s secrets synced from the SecretProviderClass
+	// Deprecated: the driver records the pods in SecretProviderClassPodStatus
+	// objects and no longer updates this field
+	ByPod []ByPodStatus `json:"byPod,omitempty"`
 }
 
 // +kubebuilder:object:root=true
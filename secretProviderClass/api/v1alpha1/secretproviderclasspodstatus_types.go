@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// InternalNodeLabel is the label of the node the pod volume is mounted on
+	InternalNodeLabel = "internal.secrets-store.csi.k8s.io/node-name"
+	// PodUIDLabel is the label of the UID of the pod consuming the volume
+	PodUIDLabel = "secrets-store.csi.k8s.io/pod-uid"
+	// PodNameLabel is the label of the name of the pod consuming the volume,
+	// set if the name is a valid label value
+	PodNameLabel = "secrets-store.csi.k8s.io/pod-name"
+	// SecretProviderClassLabel is the label of the name of the
+	// secretproviderclass of the volume, set if the name is a valid label
+	// value
+	SecretProviderClassLabel = "secrets-store.csi.k8s.io/secret-provider-class"
+	// ContentSecretLabel is the label of the secrets the nodes write the
+	// mounted content of the objects synced to K8s secrets to when the K8s
+	// secrets are synced by the secret sync controller
+	ContentSecretLabel = "internal.secrets-store.csi.k8s.io/content"
+)
+
+// SecretProviderClassObject defines the version of an object mounted from the
+// external secrets store
+type SecretProviderClassObject struct {
+	// id of the secrets store object
+	ID string `json:"id,omitempty"`
+	// version of the secrets store object
+	Version string `json:"version,omitempty"`
+}
+
+// SecretProviderClassPodStatusStatus defines the observed state of SecretProviderClassPodStatus
+type SecretProviderClassPodStatusStatus struct {
+	// name of the pod the volume is mounted in
+	PodName string `json:"podName,omitempty"`
+	// name of the SecretProviderClass used to mount the volume
+	SecretProviderClassName string `json:"secretProviderClassName,omitempty"`
+	// namespace of the SecretProviderClass, which is the pod namespace unless
+	// a shared SecretProviderClass is used
+	SecretProviderClassNamespace string `json:"secretProviderClassNamespace,omitempty"`
+	// true when the objects are mounted in the target path
+	Mounted bool `json:"mounted,omitempty"`
+	// target path of the volume on the node
+	TargetPath string `json:"targetPath,omitempty"`
+	// name of the node the volume is mounted on
+	NodeName string `json:"nodeName,omitempty"`
+	// versions of the mounted objects
+	Objects []SecretProviderClassObject `json:"objects,omitempty"`
+	// paths of the mounted files relative to the target path
+	Files []string `json:"files,omitempty"`
+	// name of the secret in the pod namespace holding the mounted content of
+	// the objects synced to K8s secrets, set when the K8s secrets are synced
+	// by the secret sync controller
+	ContentSecretName string `json:"contentSecretName,omitempty"`
+	// resource version of the content secret, changes whenever the mounted
+	// content of the synced objects changes
+	ContentSecretVersion string `json:"contentSecretVersion,omitempty"`
+	// time the node last wrote the mounted content of the synced objects to
+	// the content secret, the K8s secrets are synced from the content secret
+	// written last
+	ContentSecretUpdateTime *metav1.Time `json:"contentSecretUpdateTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretProviderClassPodStatus is the Schema for the secretproviderclasspodstatuses API
+// It records the state of a SecretProviderClass volume mounted in a pod.
+type SecretProviderClassPodStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status SecretProviderClassPodStatusStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretProviderClassPodStatusList contains a list of SecretProviderClassPodStatus
+type SecretProviderClassPodStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretProviderClassPodStatus `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretProviderClassPodStatus{}, &SecretProviderClassPodStatusList{})
+}
@@ -32,7 +32,13 @@ const (
 func TestSanity(t *testing.T) {
 	driver := secretsstore.GetDriver()
 	go func() {
-		driver.Run("secrets-store.csi.k8s.io", "somenodeid", endpoint, providerVolumePath, "provider1=0.0.2,provider2=0.0.4")
+		driver.Run(secretsstore.Options{
+			DriverName:          "secrets-store.csi.k8s.io",
+			NodeID:              "somenodeid",
+			Endpoint:            endpoint,
+			ProviderVolumePath:  providerVolumePath,
+			MinProviderVersions: "provider1=0.0.2,provider2=0.0.4",
+		})
 	}()
 
 	config := &sanity.Config{